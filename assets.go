@@ -0,0 +1,9 @@
+package main
+
+import "embed"
+
+// embeddedAssets bundles the frontend and the dataset into the binary so it
+// can be run from any working directory.
+//
+//go:embed frontend data/countries.json
+var embeddedAssets embed.FS
@@ -27,9 +27,11 @@ class GameLogic {
       format: new ol.format.GeoJSON(),
     });
 
-    fetch(
-      "https://raw.githubusercontent.com/adimail/fun-with-flags/refs/heads/master/frontend/static/countries.geo.json",
-    )
+    // Small screens get a simplified outline to keep the download light
+    const geoURL =
+      window.innerWidth < 768 ? "/api/geo?tolerance=0.05" : "/api/geo";
+
+    fetch(geoURL)
       .then((response) => response.json())
       .then((data) => {
         const features = this.vectorSource.getFormat().readFeatures(data, {
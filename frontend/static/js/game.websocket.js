@@ -59,6 +59,11 @@ class WebSocketFunWithFlags {
         // and the websocket connections are erased after this point
         this.controller.endgame();
         break;
+      case "server_shutdown":
+        // The server is restarting, the game ends when
+        // the countdown reaches zero
+        this.renderShutdownNotice(message.data.seconds);
+        break;
       default:
         console.warn("Unhandled WebSocket event:", message.event);
     }
@@ -91,6 +96,19 @@ class WebSocketFunWithFlags {
     }
   }
 
+  renderShutdownNotice(seconds) {
+    const notice =
+      document.querySelector(".shutdown-notice") ||
+      document.createElement("p");
+
+    if (!document.body.contains(notice)) {
+      notice.className = "shutdown-notice";
+      document.body.prepend(notice);
+    }
+
+    notice.textContent = `Server is restarting, the game will end in ${seconds}s`;
+  }
+
   openWebSocketConnection() {
     const WS_BASE_URL = `wss://${window.location.host}/ws`;
     const socket = new WebSocket(WS_BASE_URL);
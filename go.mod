@@ -5,3 +5,5 @@ go 1.22.3
 require github.com/gorilla/websocket v1.5.3
 
 require github.com/gorilla/mux v1.8.1
+
+require golang.org/x/crypto v0.31.0
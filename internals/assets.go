@@ -0,0 +1,29 @@
+package internals
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+)
+
+// assets is the filesystem the frontend and dataset are served from. Paths
+// are relative to the repository root, e.g. "frontend/index.html".
+var assets fs.FS = os.DirFS(".")
+
+// SetAssets replaces the filesystem used to serve the frontend and read the
+// dataset. It must be called before Router.
+func SetAssets(fsys fs.FS) {
+	assets = fsys
+}
+
+// servePage returns a handler that serves a single HTML page from the assets.
+func servePage(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, assets, name)
+	}
+}
+
+// readAsset returns the contents of a file from the assets.
+func readAsset(name string) ([]byte, error) {
+	return fs.ReadFile(assets, name)
+}
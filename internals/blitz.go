@@ -0,0 +1,124 @@
+package internals
+
+import (
+	"math"
+	"time"
+)
+
+// Per-question time limits accepted for blitz rooms, in seconds.
+const (
+	minQuestionTimeLimit = 5
+	maxQuestionTimeLimit = 30
+)
+
+// blitzBasePoints is awarded for any correct answer in a blitz room, and up
+// to blitzSpeedPoints more depending on how quickly it was given.
+const (
+	blitzBasePoints  = 5
+	blitzSpeedPoints = 5
+)
+
+// questionClock tracks the time a player has left on the current question
+// in a blitz room. A nil clock is valid and never fires.
+type questionClock struct {
+	index    int
+	limit    time.Duration
+	started  time.Time
+	deadline *time.Timer
+	ticker   *time.Ticker
+}
+
+// startQuestionClock puts a question on the clock. Time is counted from
+// started, when the question was first sent, so a clock restarted for a
+// question asked before expires no later than the first one would have.
+func startQuestionClock(index int, limit time.Duration, started time.Time) *questionClock {
+	return &questionClock{
+		index:    index,
+		limit:    limit,
+		started:  started,
+		deadline: time.NewTimer(limit - time.Since(started)),
+		ticker:   time.NewTicker(1 * time.Second),
+	}
+}
+
+// blitzQuestions remembers when each question was first put on a player's
+// clock and which are closed, answered or timed out, so that asking for a
+// question again cannot reset its timer.
+type blitzQuestions struct {
+	started map[int]time.Time
+	closed  map[int]bool
+}
+
+func newBlitzQuestions() *blitzQuestions {
+	return &blitzQuestions{
+		started: make(map[int]time.Time),
+		closed:  make(map[int]bool),
+	}
+}
+
+// start returns when a question was first put on the clock, recording now
+// if it has not been yet.
+func (b *blitzQuestions) start(index int) time.Time {
+	started, ok := b.started[index]
+	if !ok {
+		started = time.Now()
+		b.started[index] = started
+	}
+	return started
+}
+
+func (b *blitzQuestions) close(index int) {
+	b.closed[index] = true
+}
+
+func (b *blitzQuestions) isClosed(index int) bool {
+	return b.closed[index]
+}
+
+// stop releases the clock's timers.
+func (c *questionClock) stop() {
+	if c == nil {
+		return
+	}
+	c.deadline.Stop()
+	c.ticker.Stop()
+}
+
+// tick fires every second while the question is open.
+func (c *questionClock) tick() <-chan time.Time {
+	if c == nil {
+		return nil
+	}
+	return c.ticker.C
+}
+
+// expired fires once when the time limit runs out.
+func (c *questionClock) expired() <-chan time.Time {
+	if c == nil {
+		return nil
+	}
+	return c.deadline.C
+}
+
+func (c *questionClock) elapsed() time.Duration {
+	return time.Since(c.started)
+}
+
+// remaining returns the whole seconds left on the question.
+func (c *questionClock) remaining() int {
+	left := c.limit - c.elapsed()
+	if left < 0 {
+		return 0
+	}
+	return int(math.Ceil(left.Seconds()))
+}
+
+// speedPoints returns the score for a correct blitz answer given after
+// elapsed out of limit. Instant answers earn the full bonus.
+func speedPoints(elapsed, limit time.Duration) int {
+	if elapsed >= limit {
+		return blitzBasePoints
+	}
+	fraction := float64(limit-elapsed) / float64(limit)
+	return blitzBasePoints + int(math.Round(fraction*blitzSpeedPoints))
+}
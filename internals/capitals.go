@@ -0,0 +1,90 @@
+package internals
+
+import (
+	"math/rand"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// generateCapitalQuestions builds questions for the capital city modes.
+//
+// In CAPITAL mode the player sees the flag and country name and picks the
+// capital. In CAPITAL_FLAG mode the player sees the capital and picks the
+// flag, so the options and answer are flag URLs.
+//
+// Distractors are drawn from the same continent so that the options are
+// plausible, falling back to the whole catalog for small continents.
+func generateCapitalQuestions(c *catalog, numQuestions int, gameType string, rng *rand.Rand) []game.Question {
+	var candidates []game.Country
+	for _, country := range c.countries {
+		if country.Capital != "" {
+			candidates = append(candidates, country)
+		}
+	}
+
+	selected := selectRandomCountries(candidates, numQuestions, rng)
+
+	questions := make([]game.Question, 0, len(selected))
+	for _, country := range selected {
+		var question game.Question
+
+		if gameType == game.GameTypeCapitalToFlag {
+			question = game.Question{
+				Prompt: country.Capital,
+				Answer: country.FlagURL(),
+			}
+			question.Options = pickOptions(candidates, country, question.Answer, func(c *game.Country) string {
+				return c.FlagURL()
+			}, rng)
+		} else {
+			question = game.Question{
+				FlagURL: country.FlagURL(),
+				Prompt:  country.Name,
+				Answer:  country.Capital,
+			}
+			question.Options = pickOptions(candidates, country, question.Answer, func(c *game.Country) string {
+				return c.Capital
+			}, rng)
+		}
+
+		questions = append(questions, question)
+	}
+	return questions
+}
+
+// pickOptions returns the answer and three distractors in random order.
+// Distractors are the values of other countries, preferring the answer's
+// continent.
+func pickOptions(candidates []game.Country, country game.Country, answer string, value func(*game.Country) string, rng *rand.Rand) []string {
+	const numOptions = 4
+
+	var sameContinent, others []string
+	for i := range candidates {
+		candidate := &candidates[i]
+		v := value(candidate)
+		if candidate.ISO2 == country.ISO2 || v == "" || v == answer {
+			continue
+		}
+		if candidate.Continent == country.Continent {
+			sameContinent = append(sameContinent, v)
+		} else {
+			others = append(others, v)
+		}
+	}
+
+	shuffleOptions(sameContinent, rng)
+	shuffleOptions(others, rng)
+
+	options := []string{answer}
+	for _, pool := range [][]string{sameContinent, others} {
+		for _, v := range pool {
+			if len(options) == numOptions {
+				break
+			}
+			options = append(options, v)
+		}
+	}
+
+	shuffleOptions(options, rng)
+	return options
+}
@@ -0,0 +1,100 @@
+package internals
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// catalog is the in-memory country dataset, indexed by code.
+type catalog struct {
+	countries []game.Country
+	byISO2    map[string]*game.Country
+	byISO3    map[string]*game.Country
+	byNumeric map[string]*game.Country
+}
+
+var (
+	catalogOnce    sync.Once
+	countryCatalog *catalog
+	catalogErr     error
+)
+
+// getCatalog loads data/countries.json on first use and returns the
+// shared catalog.
+func getCatalog() (*catalog, error) {
+	catalogOnce.Do(func() {
+		countryCatalog, catalogErr = loadCatalog()
+	})
+	return countryCatalog, catalogErr
+}
+
+func loadCatalog() (*catalog, error) {
+	data, err := readAsset("data/countries.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var countries []game.Country
+	if err := json.Unmarshal(data, &countries); err != nil {
+		return nil, fmt.Errorf("parse countries.json: %w", err)
+	}
+
+	c := &catalog{
+		countries: countries,
+		byISO2:    make(map[string]*game.Country, len(countries)),
+		byISO3:    make(map[string]*game.Country, len(countries)),
+		byNumeric: make(map[string]*game.Country, len(countries)),
+	}
+
+	for i := range countries {
+		country := &countries[i]
+		c.byISO2[country.ISO2] = country
+		c.byISO3[country.ISO3] = country
+		c.byNumeric[country.Numeric] = country
+	}
+
+	// Palettes are a nice to have, the catalog is usable without them
+	if err := attachPalettes(c); err != nil {
+		log.Printf("Failed to extract flag colours: %v", err)
+	}
+
+	return c, nil
+}
+
+// lookup finds a country by ISO2, ISO3 or numeric code.
+func (c *catalog) lookup(code string) (*game.Country, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	var country *game.Country
+	var ok bool
+	switch len(code) {
+	case 2:
+		country, ok = c.byISO2[code]
+	case 3:
+		if country, ok = c.byISO3[code]; !ok {
+			country, ok = c.byNumeric[code]
+		}
+	}
+	return country, ok
+}
+
+// filter returns the countries of a continent, or all countries when
+// continent is empty.
+func (c *catalog) filter(continent string) []game.Country {
+	if continent == "" {
+		return append([]game.Country(nil), c.countries...)
+	}
+
+	var countries []game.Country
+	for _, country := range c.countries {
+		if strings.EqualFold(country.Continent, continent) {
+			countries = append(countries, country)
+		}
+	}
+	return countries
+}
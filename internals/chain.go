@@ -0,0 +1,318 @@
+package internals
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	mathrand "math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+	"github.com/gorilla/mux"
+)
+
+// Reasons a country cannot extend a neighbour chain.
+var (
+	errUnknownCountry = errors.New("unknown country")
+	errNotNeighbour   = errors.New("country does not border the previous one")
+	errAlreadyInChain = errors.New("country is already in the chain")
+)
+
+// chainRunTTL is how long an idle single-player chain is kept.
+const chainRunTTL = time.Hour
+
+var (
+	chainMu   sync.Mutex
+	chainRuns = make(map[string]*game.ChainRun)
+)
+
+// resolveCountry finds a country by code or by name, ignoring case, so that
+// chain answers can come from a typed name or a click on the map.
+func resolveCountry(c *catalog, answer string) (*game.Country, bool) {
+	if country, ok := c.lookup(answer); ok {
+		return country, true
+	}
+
+	answer = strings.TrimSpace(answer)
+	for i := range c.countries {
+		if strings.EqualFold(c.countries[i].Name, answer) {
+			return &c.countries[i], true
+		}
+	}
+	return nil, false
+}
+
+// chainNeighbours returns the neighbours of a country that are in the
+// catalog and not in the chain yet.
+func chainNeighbours(c *catalog, country *game.Country, links []string) []string {
+	var open []string
+	for _, code := range country.Neighbours {
+		if _, ok := c.byISO2[code]; ok && !containsString(links, code) {
+			open = append(open, code)
+		}
+	}
+	return open
+}
+
+// extendChain checks that answer names a country bordering the last link
+// of the chain that has not been visited yet.
+func extendChain(c *catalog, links []string, answer string) (*game.Country, error) {
+	country, ok := resolveCountry(c, answer)
+	if !ok {
+		return nil, errUnknownCountry
+	}
+
+	if containsString(links, country.ISO2) {
+		return country, errAlreadyInChain
+	}
+
+	last := c.byISO2[links[len(links)-1]]
+	if !containsString(last.Neighbours, country.ISO2) {
+		return country, errNotNeighbour
+	}
+
+	return country, nil
+}
+
+// pickChainStart picks a random country with at least two neighbours in the
+// catalog, so every chain can go somewhere.
+func pickChainStart(c *catalog, rng *mathrand.Rand) *game.Country {
+	var candidates []*game.Country
+	for i := range c.countries {
+		if len(chainNeighbours(c, &c.countries[i], nil)) >= 2 {
+			candidates = append(candidates, &c.countries[i])
+		}
+	}
+	return candidates[rng.Intn(len(candidates))]
+}
+
+// generateChainQuestions returns the single question of a neighbour chain
+// game: the country the chain starts from.
+func generateChainQuestions(c *catalog, rng *mathrand.Rand) []game.Question {
+	start := pickChainStart(c, rng)
+	return []game.Question{{
+		FlagURL: start.FlagURL(),
+		Prompt:  start.Name,
+		Answer:  start.Name,
+		Country: start.ISO2,
+	}}
+}
+
+func chainCountry(country *game.Country) map[string]interface{} {
+	return map[string]interface{}{
+		"iso2":     country.ISO2,
+		"name":     country.Name,
+		"flag_url": country.FlagURL(),
+	}
+}
+
+// submitChainAnswer extends a player's chain in a neighbour chain room.
+// Every link scores a point; a wrong answer or a dead end ends the run.
+func submitChainAnswer(room *game.Room, player *game.Player, answer string) {
+	c, err := getCatalog()
+	if err != nil {
+		player.Send(map[string]string{"error": "Failed to load countries"})
+		return
+	}
+
+	if len(player.Chain) == 0 {
+		player.Chain = []string{room.Questions["0"].Country}
+	}
+
+	country, err := extendChain(c, player.Chain, answer)
+
+	result := map[string]interface{}{
+		"chosen_answer": answer,
+		"correct":       err == nil,
+	}
+	if country != nil {
+		result["country"] = chainCountry(country)
+	}
+
+	if err != nil {
+		result["reason"] = err.Error()
+		result["chain_length"] = len(player.Chain) - 1
+		player.Send(map[string]interface{}{"event": "chain_result", "data": result})
+		player.Streak = 0
+		completeRun(room, player, true)
+		return
+	}
+
+	player.Chain = append(player.Chain, country.ISO2)
+	player.Score++
+	player.Streak++
+	player.BestStreak = max(player.BestStreak, player.Streak)
+
+	open := chainNeighbours(c, country, player.Chain)
+	result["chain_length"] = len(player.Chain) - 1
+	result["options_left"] = len(open)
+	player.Send(map[string]interface{}{"event": "chain_result", "data": result})
+
+	broadcastToRoom(room, scoreEvent(room, player))
+
+	// A chain with nowhere left to go is complete
+	if len(open) == 0 {
+		completeRun(room, player, false)
+	}
+}
+
+func newChainRun(c *catalog) (*game.ChainRun, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	start := pickChainStart(c, newRandomGenerator())
+	now := time.Now()
+	return &game.ChainRun{
+		ID:        hex.EncodeToString(id),
+		Links:     []string{start.ISO2},
+		StartedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// cleanupChainRuns forgets single-player chains idle for longer than
+// chainRunTTL. Callers must hold chainMu.
+func cleanupChainRuns(now time.Time) {
+	for id, run := range chainRuns {
+		if now.Sub(run.UpdatedAt) > chainRunTTL {
+			delete(chainRuns, id)
+		}
+	}
+}
+
+func chainRunView(c *catalog, run *game.ChainRun) map[string]interface{} {
+	last := c.byISO2[run.Links[len(run.Links)-1]]
+
+	links := []map[string]interface{}{}
+	for _, code := range run.Links {
+		links = append(links, chainCountry(c.byISO2[code]))
+	}
+
+	return map[string]interface{}{
+		"id":           run.ID,
+		"chain":        links,
+		"current":      chainCountry(last),
+		"chain_length": len(run.Links) - 1,
+		"options_left": len(chainNeighbours(c, last, run.Links)),
+		"over":         run.Over,
+	}
+}
+
+// startChainHandler starts a single-player neighbour chain from a random
+// country.
+//
+// HTTP Method: POST
+//
+// Response:
+//   - 200: The new chain, including its id and starting country
+//   - 500: Catalog could not be loaded
+func startChainHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := getCatalog()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to load countries: " + err.Error()})
+		return
+	}
+
+	run, err := newChainRun(c)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	chainMu.Lock()
+	cleanupChainRuns(run.StartedAt)
+	chainRuns[run.ID] = run
+	chainMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chainRunView(c, run))
+}
+
+// chainAnswerHandler extends a single-player neighbour chain with a
+// country bordering its last link.
+//
+// HTTP Method: POST
+// Content-Type: application/json
+// Path Parameter:
+//   - id: Chain identifier
+//
+// Request Body:
+//   - answer: Name or ISO code of the next country
+//
+// Response:
+//   - 200: Whether the answer was valid, and the updated chain
+//   - 400: Invalid request
+//   - 404: Chain not found
+//   - 409: The chain is already over
+func chainAnswerHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Answer string `json:"answer"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON format"})
+		return
+	}
+
+	c, err := getCatalog()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to load countries: " + err.Error()})
+		return
+	}
+
+	chainMu.Lock()
+	defer chainMu.Unlock()
+
+	run, ok := chainRuns[mux.Vars(r)["id"]]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Chain not found"})
+		return
+	}
+
+	if run.Over {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Chain is already over"})
+		return
+	}
+
+	country, err := extendChain(c, run.Links, req.Answer)
+	if err == nil {
+		run.Links = append(run.Links, country.ISO2)
+	}
+	run.UpdatedAt = time.Now()
+
+	view := chainRunView(c, run)
+	run.Over = err != nil || view["options_left"] == 0
+	view["over"] = run.Over
+
+	response := map[string]interface{}{
+		"correct": err == nil,
+		"chain":   view,
+	}
+	if err != nil {
+		response["reason"] = err.Error()
+	}
+	if country != nil {
+		response["country"] = chainCountry(country)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
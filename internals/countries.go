@@ -0,0 +1,100 @@
+package internals
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+
+	"github.com/gorilla/mux"
+)
+
+// countriesHandler returns the country catalog.
+//
+// HTTP Method: GET
+// Query Parameters:
+//   - continent: Optional continent name restricting the list
+//   - colors: Optional comma-separated colour names, such as "red,white";
+//     only countries whose flag has all of them are listed
+//
+// Response:
+//   - 200: List of countries
+//   - 400: Unknown colour name
+//   - 500: Catalog could not be loaded
+func countriesHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := getCatalog()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to load countries: " + err.Error()})
+		return
+	}
+
+	countries := c.filter(r.URL.Query().Get("continent"))
+
+	if colors := r.URL.Query().Get("colors"); colors != "" {
+		var names []string
+		for _, name := range strings.Split(colors, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "gray" {
+				name = "grey"
+			}
+			if !containsString(colorNames, name) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(ErrorResponse{
+					Error: fmt.Sprintf("Unknown colour %q, expected one of %s", name, strings.Join(colorNames, ", ")),
+				})
+				return
+			}
+			names = append(names, name)
+		}
+
+		matching := []game.Country{}
+		for i := range countries {
+			if hasColors(&countries[i], names) {
+				matching = append(matching, countries[i])
+			}
+		}
+		countries = matching
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":     len(countries),
+		"countries": countries,
+	})
+}
+
+// countryHandler returns a single country of the catalog.
+//
+// HTTP Method: GET
+// Path Parameter:
+//   - code: ISO 3166-1 alpha-2, alpha-3 or numeric code
+//
+// Response:
+//   - 200: Country details
+//   - 404: No country with that code
+//   - 500: Catalog could not be loaded
+func countryHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := getCatalog()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to load countries: " + err.Error()})
+		return
+	}
+
+	country, ok := c.lookup(mux.Vars(r)["code"])
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Country not found"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(country)
+}
@@ -0,0 +1,452 @@
+package internals
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// dailyQuestions is the number of questions of a daily challenge.
+const dailyQuestions = 10
+
+// maxDailyRunsPerAddress is the number of runs of a day's challenge that
+// can be started from one address. It keeps players from learning the
+// answers with throwaway identities before playing for the leaderboard.
+const maxDailyRunsPerAddress = 5
+
+// dailyChallenge is the question set of one day and the runs played on it.
+// ranked caches the completed runs in order, and positions the index of
+// each player in it; both are rebuilt only after a run completes.
+type dailyChallenge struct {
+	date      string
+	questions []game.Question
+	runs      map[string]*game.DailyRun
+	starts    map[string]int // runs started per client address
+	ranked    []*game.DailyRun
+	positions map[string]int
+}
+
+// dailyChallenges holds the challenges of today and yesterday, so that a
+// run started just before midnight can still be finished.
+var (
+	dailyMu         sync.Mutex
+	dailyChallenges = make(map[string]*dailyChallenge)
+)
+
+var (
+	errDailyIdentity = errors.New("Daily challenge needs a guest identity, load the site or /api/identity first")
+	errDailyLimit    = errors.New("Too many daily challenge runs started from this address today")
+)
+
+// dailyDate returns the UTC day of t, which names its daily challenge.
+func dailyDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// dailySeed derives the random seed of a day's challenge from the server
+// secret, so the questions are the same for everyone but cannot be worked
+// out in advance.
+func dailySeed(date string) int64 {
+	mac := hmac.New(sha256.New, serverSecret)
+	mac.Write([]byte("daily:" + date))
+	return int64(binary.BigEndian.Uint64(mac.Sum(nil)))
+}
+
+// dailyQuestionSet builds the MCQ questions of a day's challenge. The flags
+// and the order of their options depend only on the date and the secret.
+func dailyQuestionSet(date string) ([]game.Question, error) {
+	c, err := getCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(dailySeed(date)))
+	selected := selectRandomCountries(c.filter(""), dailyQuestions, rng)
+
+	questions := make([]game.Question, 0, len(selected))
+	for _, country := range selected {
+		questions = append(questions, game.Question{
+			FlagURL: country.FlagURL(),
+			Answer:  country.Name,
+			Options: pickOptions(c.countries, country, country.Name, func(c *game.Country) string {
+				return c.Name
+			}, rng),
+		})
+	}
+	return questions, nil
+}
+
+// challengeOn returns the challenge of date, building it and loading its
+// runs on first use. Challenges older than yesterday are dropped. The
+// caller must hold dailyMu.
+func challengeOn(date string) (*dailyChallenge, error) {
+	if challenge, ok := dailyChallenges[date]; ok {
+		return challenge, nil
+	}
+
+	questions, err := dailyQuestionSet(date)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := dataStore.DailyRuns(date)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := &dailyChallenge{
+		date:      date,
+		questions: questions,
+		runs:      make(map[string]*game.DailyRun, len(stored)),
+		starts:    make(map[string]int),
+	}
+	for i := range stored {
+		challenge.runs[stored[i].PlayerID] = &stored[i]
+	}
+
+	yesterday := dailyDate(time.Now().AddDate(0, 0, -1))
+	for d := range dailyChallenges {
+		if d < yesterday {
+			delete(dailyChallenges, d)
+		}
+	}
+	dailyChallenges[date] = challenge
+	return challenge, nil
+}
+
+// todayChallenge returns the challenge of the current day. The caller must
+// hold dailyMu.
+func todayChallenge() (*dailyChallenge, error) {
+	return challengeOn(dailyDate(time.Now()))
+}
+
+// activeDailyRun returns the run a player is playing: today's, or one they
+// started yesterday and have not finished. It returns a nil run if they
+// have neither. The caller must hold dailyMu.
+func activeDailyRun(playerID string) (*dailyChallenge, *game.DailyRun, error) {
+	today, err := todayChallenge()
+	if err != nil {
+		return nil, nil, err
+	}
+	if run := today.runs[playerID]; run != nil {
+		return today, run, nil
+	}
+
+	yesterday, err := challengeOn(dailyDate(time.Now().AddDate(0, 0, -1)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if run := yesterday.runs[playerID]; run != nil && run.CompletedAt == nil {
+		return yesterday, run, nil
+	}
+	return today, nil, nil
+}
+
+// dailyAnswers lists the answers of a challenge in question order.
+func dailyAnswers(challenge *dailyChallenge) []string {
+	answers := make([]string, len(challenge.questions))
+	for i, question := range challenge.questions {
+		answers[i] = question.Answer
+	}
+	return answers
+}
+
+func saveDailyRun(run *game.DailyRun) {
+	if err := dataStore.SaveDailyRun(*run); err != nil {
+		log.Printf("Failed to save daily run of %s: %v", run.PlayerID, err)
+	}
+}
+
+// rank returns the completed runs in order: by correct answers, then by
+// the time taken.
+func (d *dailyChallenge) rank() ([]*game.DailyRun, map[string]int) {
+	if d.ranked != nil {
+		return d.ranked, d.positions
+	}
+
+	ranked := []*game.DailyRun{}
+	for _, run := range d.runs {
+		if run.CompletedAt != nil {
+			ranked = append(ranked, run)
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.Correct() != b.Correct() {
+			return a.Correct() > b.Correct()
+		}
+		if a.Duration() != b.Duration() {
+			return a.Duration() < b.Duration()
+		}
+		return a.PlayerID < b.PlayerID
+	})
+	positions := make(map[string]int, len(ranked))
+	for i, run := range ranked {
+		positions[run.PlayerID] = i
+	}
+	d.ranked, d.positions = ranked, positions
+	return ranked, positions
+}
+
+// dailyShareText is the spoiler-free result of a run: the score and time,
+// then one square per question without revealing the flags.
+func dailyShareText(run *game.DailyRun) string {
+	var text strings.Builder
+
+	seconds := int(run.Duration().Seconds())
+	fmt.Fprintf(&text, "Fun with Flags Daily %s\n%d/%d in %d:%02d\n",
+		run.Date, run.Correct(), len(run.Results), seconds/60, seconds%60)
+
+	for i, ok := range run.Results {
+		if ok {
+			text.WriteString("🟩")
+		} else {
+			text.WriteString("🟥")
+		}
+		if i%5 == 4 || i == len(run.Results)-1 {
+			text.WriteString("\n")
+		}
+	}
+	return text.String()
+}
+
+// dailyView is the player's view of their run. It only includes the current
+// question, without its answer, and the summary with every answer once the
+// run is complete.
+func dailyView(challenge *dailyChallenge, run *game.DailyRun) map[string]interface{} {
+	index := len(run.Results)
+	view := map[string]interface{}{
+		"date":      challenge.date,
+		"index":     index,
+		"total":     len(challenge.questions),
+		"correct":   run.Correct(),
+		"completed": run.CompletedAt != nil,
+	}
+
+	if run.CompletedAt != nil {
+		ranked, positions := challenge.rank()
+		view["summary"] = map[string]interface{}{
+			"correct":          run.Correct(),
+			"total":            len(run.Results),
+			"duration_seconds": int(run.Duration().Seconds()),
+			"rank":             positions[run.PlayerID] + 1,
+			"players":          len(ranked),
+			"share":            dailyShareText(run),
+			"answers":          dailyAnswers(challenge),
+		}
+	} else {
+		question := challenge.questions[index]
+		view["question"] = map[string]interface{}{
+			"question_index": index,
+			"flag_url":       question.FlagURL,
+			"options":        question.Options,
+		}
+	}
+
+	return view
+}
+
+// dailyHandler starts the caller's run of today's challenge, or resumes
+// their current run. A completed run is returned with its summary rather
+// than played again. Runs are tied to the caller's signed identity, which
+// must have been issued before, and only a few can be started from one
+// address a day. It is served by SinglePlayerHandler for the DAILY game
+// type.
+func dailyHandler(w http.ResponseWriter, r *http.Request) {
+	identity := requestIdentity(r)
+	if !playerIDPattern.MatchString(identity.ID) || identity.issued {
+		http.Error(w, errDailyIdentity.Error(), http.StatusForbidden)
+		return
+	}
+	playerID := identity.ID
+
+	dailyMu.Lock()
+	defer dailyMu.Unlock()
+
+	challenge, run, err := activeDailyRun(playerID)
+	if err != nil {
+		http.Error(w, "Failed to generate questions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if run == nil {
+		address := clientAddress(r)
+		if challenge.starts[address] >= maxDailyRunsPerAddress {
+			http.Error(w, errDailyLimit.Error(), http.StatusTooManyRequests)
+			return
+		}
+		challenge.starts[address]++
+
+		username := identity.Username
+		if username == "" {
+			username = "Guest"
+		}
+		run = &game.DailyRun{
+			PlayerID:  playerID,
+			Username:  username,
+			Date:      challenge.date,
+			Results:   []bool{},
+			StartedAt: time.Now(),
+		}
+		challenge.runs[playerID] = run
+		saveDailyRun(run)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dailyView(challenge, run))
+}
+
+// dailyAnswerHandler records the answer to the current question of the
+// caller's daily run. The correct answers are only revealed once the last
+// answer completes the run and places it on the daily leaderboard.
+//
+// HTTP Method: POST
+// Content-Type: application/json
+//
+// Request Body:
+//   - question_index: Index of the question being answered
+//   - answer: The chosen country name
+//
+// Response:
+//   - 200: Whether the answer was correct and the updated run, with the
+//     summary, answers and share text once it is complete
+//   - 400: Invalid request
+//   - 404: The caller has no daily run in progress
+//   - 409: The question is not the run's current question, or the run is complete
+func dailyAnswerHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		QuestionIndex int    `json:"question_index"`
+		Answer        string `json:"answer"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON format"})
+		return
+	}
+
+	playerID := requestPlayerID(r)
+
+	dailyMu.Lock()
+	defer dailyMu.Unlock()
+
+	challenge, run, err := activeDailyRun(playerID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if run == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "No daily challenge run in progress"})
+		return
+	}
+
+	if run.CompletedAt != nil || req.QuestionIndex != len(run.Results) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Question is not the current question of this run"})
+		return
+	}
+
+	question := challenge.questions[req.QuestionIndex]
+	isCorrect := question.Answer == req.Answer
+
+	run.Results = append(run.Results, isCorrect)
+	if len(run.Results) == len(challenge.questions) {
+		completedAt := time.Now()
+		run.CompletedAt = &completedAt
+		challenge.ranked, challenge.positions = nil, nil
+	}
+	saveDailyRun(run)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"correct":       isCorrect,
+		"chosen_answer": req.Answer,
+		"run":           dailyView(challenge, run),
+	})
+}
+
+// dailyLeaderboardHandler ranks the completed runs of today's challenge.
+//
+// HTTP Method: GET
+// Query Parameters:
+//   - limit: Number of players listed (default 10, at most 100)
+//
+// Response:
+//   - 200: The ranked players and the caller's entry, which is null if
+//     they have not completed today's challenge
+//   - 400: Invalid limit
+//   - 500: The challenge could not be loaded
+func dailyLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultLeaderboardLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > maxLeaderboardLimit {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("limit must be between 1 and %d", maxLeaderboardLimit)})
+			return
+		}
+	}
+
+	playerID := requestPlayerID(r)
+
+	dailyMu.Lock()
+	defer dailyMu.Unlock()
+
+	challenge, err := todayChallenge()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	view := func(run *game.DailyRun, rank int) map[string]interface{} {
+		return map[string]interface{}{
+			"rank":             rank,
+			"player":           publicPlayerID(run.PlayerID),
+			"username":         run.Username,
+			"correct":          run.Correct(),
+			"duration_seconds": int(run.Duration().Seconds()),
+		}
+	}
+
+	ranked, positions := challenge.rank()
+	entries := []map[string]interface{}{}
+	for i := 0; i < limit && i < len(ranked); i++ {
+		entries = append(entries, view(ranked[i], i+1))
+	}
+	var me map[string]interface{}
+	if i, ok := positions[playerID]; ok {
+		me = view(ranked[i], i+1)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"date":    challenge.date,
+		"total":   len(challenge.questions),
+		"players": len(ranked),
+		"entries": entries,
+		"me":      me,
+	})
+}
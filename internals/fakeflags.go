@@ -0,0 +1,457 @@
+package internals
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"math/rand"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+	"github.com/gorilla/mux"
+)
+
+// numFakeFlags is the number of generated fakes shown next to the real flag.
+const numFakeFlags = 3
+
+// sameFlagSimilarity is the share of matching raster cells above which two
+// flags are considered the same. It leaves room for differences in how
+// flags are drawn and for the approximations of the rasterizer.
+const sameFlagSimilarity = 0.95
+
+// minPaletteCells is the number of raster cells a colour must cover to be
+// swapped. Smaller details would not make a visible difference.
+const minPaletteCells = 8
+
+// Kinds of flag mutation.
+const (
+	mutationSwap    = "swap"    // two colours trade places
+	mutationRecolor = "recolor" // one colour is replaced by another flag colour
+	mutationMirror  = "mirror"  // flipped left to right, mirroring emblems
+	mutationFlip    = "flip"    // flipped top to bottom, reordering stripes
+)
+
+// flagColors are common flag colours used to recolour fakes.
+var flagColors = []string{"#ce1126", "#0038a8", "#009639", "#fcd116", "#000000", "#ffffff", "#ff883e"}
+
+// flagMutation is a change that turns a real flag into a fake one.
+type flagMutation struct {
+	kind string
+	a, b string // colours traded by a swap, or a replaced by b
+}
+
+var paintPattern = regexp.MustCompile(`((?:fill|stroke|stop-color)\s*(?:=\s*["']|:\s*))([^"';]+)`)
+
+var (
+	flagRastersOnce sync.Once
+	flagRasters     map[string]*flagRaster
+	flagRastersErr  error
+)
+
+// getFlagRasters rasterizes every flag in frontend/static/svg on first use
+// and returns the rasters keyed by ISO2. Flags that cannot be rasterized
+// are left out.
+func getFlagRasters() (map[string]*flagRaster, error) {
+	flagRastersOnce.Do(func() {
+		flagRasters, flagRastersErr = loadFlagRasters()
+	})
+	return flagRasters, flagRastersErr
+}
+
+func loadFlagRasters() (map[string]*flagRaster, error) {
+	files, err := fs.Glob(assets, "frontend/static/svg/*.svg")
+	if err != nil {
+		return nil, err
+	}
+
+	rasters := make(map[string]*flagRaster, len(files))
+	for _, file := range files {
+		data, err := readAsset(file)
+		if err != nil {
+			return nil, err
+		}
+		raster, err := rasterizeSVG(data)
+		if err != nil {
+			log.Printf("Failed to rasterize %s: %v", file, err)
+			continue
+		}
+		rasters[strings.TrimSuffix(path.Base(file), ".svg")] = raster
+	}
+	return rasters, nil
+}
+
+// flagVariants is the set of options of a "spot the real flag" question.
+type flagVariants struct {
+	real      int             // index of the real flag among the options
+	mutations []*flagMutation // nil for the real flag
+}
+
+// maxFlagVariantPlans bounds the plans kept by cachedFlagVariants.
+const maxFlagVariantPlans = 1024
+
+// flagVariantKey identifies the plan of a "spot the real flag" question.
+type flagVariantKey struct {
+	iso2 string
+	seed int64
+}
+
+var (
+	flagVariantMu    sync.Mutex
+	flagVariantPlans = make(map[flagVariantKey]*flagVariants)
+	flagVariantOrder []flagVariantKey // oldest first
+)
+
+// cachedFlagVariants returns the plan of a question, planning it on first
+// use. Each option image of a question is served by its own request, so
+// the plan is kept rather than worked out again for every one of them.
+// Once maxFlagVariantPlans are kept, the oldest is dropped.
+func cachedFlagVariants(iso2 string, seed int64) (*flagVariants, error) {
+	key := flagVariantKey{iso2, seed}
+
+	flagVariantMu.Lock()
+	variants, ok := flagVariantPlans[key]
+	flagVariantMu.Unlock()
+	if ok {
+		return variants, nil
+	}
+
+	variants, err := planFlagVariants(iso2, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	flagVariantMu.Lock()
+	defer flagVariantMu.Unlock()
+
+	if _, ok := flagVariantPlans[key]; !ok {
+		if len(flagVariantOrder) >= maxFlagVariantPlans {
+			delete(flagVariantPlans, flagVariantOrder[0])
+			flagVariantOrder = flagVariantOrder[1:]
+		}
+		flagVariantPlans[key] = variants
+		flagVariantOrder = append(flagVariantOrder, key)
+	}
+	return variants, nil
+}
+
+// planFlagVariants picks the fakes shown for a country's flag. The plan only
+// depends on the seed, so variants can be served one at a time by URL.
+// Mutations that look like the real flag, another country's flag or an
+// earlier fake are rejected, so fewer fakes may be returned.
+func planFlagVariants(iso2 string, seed int64) (*flagVariants, error) {
+	rasters, err := getFlagRasters()
+	if err != nil {
+		return nil, err
+	}
+
+	original, ok := rasters[iso2]
+	if !ok {
+		return nil, fmt.Errorf("no flag for %s", iso2)
+	}
+
+	svg, err := readAsset("frontend/static/svg/" + iso2 + ".svg")
+	if err != nil {
+		return nil, err
+	}
+
+	// Candidates are grouped by kind and taken in turns, so a question mixes
+	// different kinds of fakes
+	buckets := [][]*flagMutation{{{kind: mutationMirror}}, {{kind: mutationFlip}}, nil, nil}
+	colors := swappableColors(svg, original)
+	for i := range colors {
+		for j := i + 1; j < len(colors); j++ {
+			buckets[2] = append(buckets[2], &flagMutation{kind: mutationSwap, a: colors[i], b: colors[j]})
+		}
+		for _, replacement := range flagColors {
+			if !containsSimilarColor(colors, replacement) {
+				buckets[3] = append(buckets[3], &flagMutation{kind: mutationRecolor, a: colors[i], b: replacement})
+			}
+		}
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	rng.Shuffle(len(buckets), func(i, j int) {
+		buckets[i], buckets[j] = buckets[j], buckets[i]
+	})
+	for _, bucket := range buckets {
+		rng.Shuffle(len(bucket), func(i, j int) {
+			bucket[i], bucket[j] = bucket[j], bucket[i]
+		})
+	}
+
+	var candidates []*flagMutation
+	for round := 0; len(candidates) < countMutations(buckets); round++ {
+		for _, bucket := range buckets {
+			if round < len(bucket) {
+				candidates = append(candidates, bucket[round])
+			}
+		}
+	}
+
+	codes := sortedKeys(rasters)
+	var mutations []*flagMutation
+	seen := []*flagRaster{original}
+	for _, mutation := range candidates {
+		if len(mutations) == numFakeFlags {
+			break
+		}
+
+		mutated := mutation.applyRaster(original)
+		if looksLikeAny(mutated, seen) || looksLikeRealFlag(mutated, iso2, codes, rasters) {
+			continue
+		}
+		mutations = append(mutations, mutation)
+		seen = append(seen, mutated)
+	}
+
+	variants := &flagVariants{real: rng.Intn(len(mutations) + 1)}
+	variants.mutations = append(variants.mutations, mutations[:variants.real]...)
+	variants.mutations = append(variants.mutations, nil)
+	variants.mutations = append(variants.mutations, mutations[variants.real:]...)
+	return variants, nil
+}
+
+// swappableColors returns the colours covering a visible part of the
+// raster that are set explicitly in the SVG, so a swap changes the image
+// exactly as it changes the raster.
+func swappableColors(svg []byte, raster *flagRaster) []string {
+	explicit := make(map[string]bool)
+	for _, match := range paintPattern.FindAllStringSubmatch(string(svg), -1) {
+		if color := normalizeColor(match[2]); color != "" {
+			explicit[color] = true
+		}
+	}
+
+	cells := make(map[string]int)
+	for _, row := range raster {
+		for _, color := range row {
+			cells[color]++
+		}
+	}
+
+	var colors []string
+	for _, color := range sortedKeys(cells) {
+		if explicit[color] && cells[color] >= minPaletteCells {
+			colors = append(colors, color)
+		}
+	}
+	return colors
+}
+
+func countMutations(buckets [][]*flagMutation) int {
+	n := 0
+	for _, bucket := range buckets {
+		n += len(bucket)
+	}
+	return n
+}
+
+func containsSimilarColor(colors []string, color string) bool {
+	for _, c := range colors {
+		if similarColors(c, color) {
+			return true
+		}
+	}
+	return false
+}
+
+func looksLikeAny(raster *flagRaster, others []*flagRaster) bool {
+	for _, other := range others {
+		if raster.similarity(other) >= sameFlagSimilarity {
+			return true
+		}
+	}
+	return false
+}
+
+func looksLikeRealFlag(raster *flagRaster, iso2 string, codes []string, rasters map[string]*flagRaster) bool {
+	for _, code := range codes {
+		if code != iso2 && raster.similarity(rasters[code]) >= sameFlagSimilarity {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRaster returns the raster of the mutated flag.
+func (m *flagMutation) applyRaster(raster *flagRaster) *flagRaster {
+	var mutated flagRaster
+	for y := range raster {
+		for x := range raster[y] {
+			switch m.kind {
+			case mutationMirror:
+				mutated[y][x] = raster[y][rasterWidth-1-x]
+			case mutationFlip:
+				mutated[y][x] = raster[rasterHeight-1-y][x]
+			case mutationSwap, mutationRecolor:
+				mutated[y][x] = m.swap(raster[y][x])
+			}
+		}
+	}
+	return &mutated
+}
+
+func (m *flagMutation) swap(color string) string {
+	switch {
+	case color == m.a:
+		return m.b
+	case color == m.b && m.kind == mutationSwap:
+		return m.a
+	}
+	return color
+}
+
+// applySVG rewrites a flag's SVG with the mutation. A nil mutation returns
+// the real flag, rewritten the same way as the fakes so that it cannot be
+// told apart by its markup.
+func (m *flagMutation) applySVG(svg []byte) ([]byte, error) {
+	start := svgRootPattern.FindIndex(svg)
+	if start == nil {
+		return nil, fmt.Errorf("no svg root element")
+	}
+	end := strings.LastIndex(string(svg), "</svg>")
+	if end < start[1] {
+		return nil, fmt.Errorf("no closing svg tag")
+	}
+
+	x, y, width, height, err := parseViewBox(string(svg[start[0]:start[1]]))
+	if err != nil {
+		return nil, err
+	}
+
+	body := string(svg[start[1]:end])
+	body = svgCommentPattern.ReplaceAllString(body, "")
+	body = svgTextPattern.ReplaceAllString(body, "")
+
+	transform := "matrix(1 0 0 1 0 0)"
+	switch {
+	case m == nil:
+	case m.kind == mutationMirror:
+		transform = fmt.Sprintf("matrix(-1 0 0 1 %s 0)", formatCoordinate(2*x+width))
+	case m.kind == mutationFlip:
+		transform = fmt.Sprintf("matrix(1 0 0 -1 0 %s)", formatCoordinate(2*y+height))
+	case m.kind == mutationSwap, m.kind == mutationRecolor:
+		body = paintPattern.ReplaceAllStringFunc(body, func(paint string) string {
+			match := paintPattern.FindStringSubmatch(paint)
+			color := normalizeColor(match[2])
+			if color == "" || m.swap(color) == color {
+				return paint
+			}
+			return match[1] + m.swap(color)
+		})
+	}
+
+	root := string(svg[start[0]:start[1]])
+	return []byte(root + `<g transform="` + transform + `">` + body + "</g></svg>\n"), nil
+}
+
+// flagVariantURL is the URL an option of a "spot the real flag" question
+// is served from.
+func flagVariantURL(iso2 string, seed int64, option int) string {
+	return fmt.Sprintf("/api/flags/%s/variant?seed=%d&option=%d", iso2, seed, option)
+}
+
+// generateSpotRealQuestions builds questions that show a country's name and
+// ask the player to pick its real flag among generated fakes. Countries
+// whose flags do not give enough distinct fakes are skipped.
+func generateSpotRealQuestions(c *catalog, numQuestions int, rng *rand.Rand) ([]game.Question, error) {
+	countries := c.filter("")
+	shuffleCountries(countries, rng)
+
+	questions := make([]game.Question, 0, numQuestions)
+	for _, country := range countries {
+		if len(questions) == numQuestions {
+			break
+		}
+
+		seed := newQuestionSeed(rng)
+		variants, err := cachedFlagVariants(country.ISO2, seed)
+		if err != nil {
+			return nil, err
+		}
+		if len(variants.mutations) < numFakeFlags+1 {
+			continue
+		}
+
+		question := game.Question{
+			Prompt:  country.Name,
+			Answer:  flagVariantURL(country.ISO2, seed, variants.real),
+			Country: country.ISO2,
+			Seed:    seed,
+		}
+		for i := range variants.mutations {
+			question.Options = append(question.Options, flagVariantURL(country.ISO2, seed, i))
+		}
+		questions = append(questions, question)
+	}
+	return questions, nil
+}
+
+// flagVariantHandler serves one option of a "spot the real flag" question,
+// either the real flag or a generated fake.
+//
+// HTTP Method: GET
+// Path Parameter:
+//   - code: ISO 3166-1 alpha-2, alpha-3 or numeric code
+//
+// Query Parameters:
+//   - seed: Seed of the question
+//   - option: Index of the option
+//
+// Response:
+//   - 200: The SVG of the option
+//   - 400: Invalid seed or option
+//   - 404: No country with that code
+//   - 500: The flag could not be read or rewritten
+func flagVariantHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := getCatalog()
+	if err != nil {
+		http.Error(w, "Failed to load countries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	country, ok := c.lookup(mux.Vars(r)["code"])
+	if !ok {
+		http.Error(w, "Country not found", http.StatusNotFound)
+		return
+	}
+
+	seed, err := strconv.ParseInt(r.URL.Query().Get("seed"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid seed", http.StatusBadRequest)
+		return
+	}
+
+	variants, err := cachedFlagVariants(country.ISO2, seed)
+	if err != nil {
+		http.Error(w, "Failed to generate flags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	option, err := strconv.Atoi(r.URL.Query().Get("option"))
+	if err != nil || option < 0 || option >= len(variants.mutations) {
+		http.Error(w, "Invalid option", http.StatusBadRequest)
+		return
+	}
+
+	svg, err := readAsset("frontend/static/svg/" + country.ISO2 + ".svg")
+	if err != nil {
+		http.Error(w, "Failed to read flag: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	variant, err := variants.mutations[option].applySVG(svg)
+	if err != nil {
+		http.Error(w, "Failed to generate flag: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(variant)
+}
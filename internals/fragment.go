@@ -0,0 +1,178 @@
+package internals
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// zoomFractions is the share of the flag's width and height shown at each
+// reveal level of a zoom question. The last level shows the whole flag.
+var zoomFractions = []float64{0.25, 0.45, 0.7, 1}
+
+// maxRevealLevel is the reveal level that shows the whole flag.
+var maxRevealLevel = len(zoomFractions) - 1
+
+var (
+	svgRootPattern    = regexp.MustCompile(`(?s)<svg\b[^>]*>`)
+	svgAttrPattern    = regexp.MustCompile(`\s(viewBox|width|height)\s*=\s*"([^"]*)"`)
+	svgCommentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+	// Titles and descriptions usually name the country
+	svgTextPattern = regexp.MustCompile(`(?s)<(title|desc|metadata)\b.*?</(title|desc|metadata)>`)
+)
+
+var errNoViewBox = errors.New("flag has neither a viewBox nor a width and height")
+
+// newQuestionSeed returns a seed for a generated question. Seeds stay
+// within the integers JavaScript can represent, as clients echo them back.
+func newQuestionSeed(rng *rand.Rand) int64 {
+	return rng.Int63n(1 << 53)
+}
+
+// zoomPoints returns the score for a correct zoom answer given at the
+// reveal level. Answering from the smallest fragment earns the most.
+func zoomPoints(level int) int {
+	return len(zoomFractions) - level
+}
+
+// flagFragment returns the flag of the country with the given ISO2 code,
+// cropped to the reveal level. The seed picks the part of the flag that
+// is zoomed into, so the same seed always reveals the same area.
+func flagFragment(iso2 string, seed int64, level int) ([]byte, error) {
+	svg, err := readAsset("frontend/static/svg/" + iso2 + ".svg")
+	if err != nil {
+		return nil, err
+	}
+	return cropSVG(svg, seed, level)
+}
+
+// cropSVG rewrites the viewBox of the svg root element to show a fragment
+// of the image for the reveal level. Every level of a seed zooms out
+// around the same point.
+func cropSVG(svg []byte, seed int64, level int) ([]byte, error) {
+	if level < 0 || level > maxRevealLevel {
+		return nil, fmt.Errorf("reveal level must be between 0 and %d", maxRevealLevel)
+	}
+
+	root := svgRootPattern.Find(svg)
+	if root == nil {
+		return nil, errors.New("no svg root element")
+	}
+
+	x, y, width, height, err := parseViewBox(string(root))
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	u, v := rng.Float64(), rng.Float64()
+
+	fraction := zoomFractions[level]
+	cropWidth, cropHeight := width*fraction, height*fraction
+	viewBox := strings.Join([]string{
+		formatCoordinate(x + u*(width-cropWidth)),
+		formatCoordinate(y + v*(height-cropHeight)),
+		formatCoordinate(cropWidth),
+		formatCoordinate(cropHeight),
+	}, " ")
+
+	// The original width and height are kept so the fragment is shown at
+	// the size of the full flag
+	newRoot := svgAttrPattern.ReplaceAllStringFunc(string(root), func(attr string) string {
+		if strings.HasPrefix(strings.TrimSpace(attr), "viewBox") {
+			return ""
+		}
+		return attr
+	})
+	newRoot = strings.Replace(newRoot, "<svg", `<svg viewBox="`+viewBox+`"`, 1)
+
+	start := svgRootPattern.FindIndex(svg)
+	body := string(svg[start[1]:])
+	body = svgCommentPattern.ReplaceAllString(body, "")
+	body = svgTextPattern.ReplaceAllString(body, "")
+
+	return []byte(newRoot + body), nil
+}
+
+// parseViewBox returns the viewBox of an svg root element, falling back to
+// its width and height.
+func parseViewBox(root string) (x, y, width, height float64, err error) {
+	attrs := map[string]string{}
+	for _, match := range svgAttrPattern.FindAllStringSubmatch(root, -1) {
+		attrs[match[1]] = match[2]
+	}
+
+	if viewBox, ok := attrs["viewBox"]; ok {
+		fields := strings.FieldsFunc(viewBox, func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+		if len(fields) != 4 {
+			return 0, 0, 0, 0, fmt.Errorf("invalid viewBox %q", viewBox)
+		}
+		values := make([]float64, 4)
+		for i, field := range fields {
+			if values[i], err = strconv.ParseFloat(field, 64); err != nil {
+				return 0, 0, 0, 0, fmt.Errorf("invalid viewBox %q", viewBox)
+			}
+		}
+		return values[0], values[1], values[2], values[3], nil
+	}
+
+	width, errWidth := strconv.ParseFloat(strings.TrimSuffix(attrs["width"], "px"), 64)
+	height, errHeight := strconv.ParseFloat(strings.TrimSuffix(attrs["height"], "px"), 64)
+	if errWidth != nil || errHeight != nil {
+		return 0, 0, 0, 0, errNoViewBox
+	}
+	return 0, 0, width, height, nil
+}
+
+func formatCoordinate(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+// addFragment replaces the flag URL of a zoom question with the flag
+// cropped to the player's reveal level, so the country is not given away.
+func addFragment(data map[string]interface{}, question *game.Question, level int) error {
+	fragment, err := flagFragment(question.Country, question.Seed, level)
+	if err != nil {
+		return err
+	}
+
+	delete(data, "flag_url")
+	data["fragment"] = string(fragment)
+	data["reveal_level"] = level
+	data["max_reveal_level"] = maxRevealLevel
+	return nil
+}
+
+// revealFragment shows more of the current zoom question's flag to the
+// player, up to level.
+func revealFragment(room *game.Room, player *game.Player, level int) {
+	if level <= player.RevealLevel || level > maxRevealLevel {
+		return
+	}
+
+	question := room.Questions[strconv.Itoa(player.RevealIndex)]
+	fragment, err := flagFragment(question.Country, question.Seed, level)
+	if err != nil {
+		log.Printf("Failed to crop flag %s: %v", question.Country, err)
+		return
+	}
+
+	player.RevealLevel = level
+	player.Send(map[string]interface{}{
+		"event": "flag_fragment",
+		"data": map[string]interface{}{
+			"question_index": player.RevealIndex,
+			"fragment":       string(fragment),
+			"reveal_level":   level,
+		},
+	})
+}
@@ -0,0 +1,13 @@
+package game
+
+import "time"
+
+// ChainRun is a single-player neighbour chain. Each link borders the one
+// before it and no country appears twice.
+type ChainRun struct {
+	ID        string    `json:"id"`
+	Links     []string  `json:"links"` // ISO2 codes, starting country first
+	Over      bool      `json:"over"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,34 @@
+package game
+
+// Country is a single entry of the country catalog.
+type Country struct {
+	Name       string   `json:"name"`
+	ISO2       string   `json:"iso2"`
+	ISO3       string   `json:"iso3"`
+	Numeric    string   `json:"numeric"`
+	Capital    string   `json:"capital"`
+	Continent  string   `json:"continent"`
+	Subregion  string   `json:"subregion"`
+	Population int64    `json:"population"`
+	Area       float64  `json:"area"` // in square kilometres
+	Languages  []string `json:"languages"`
+	Neighbours []string `json:"neighbours"` // ISO2 codes of land neighbours
+	Lat        float64  `json:"lat"`
+	Lon        float64  `json:"lon"`
+
+	// Colors is the flag's palette, most dominant first. It is extracted
+	// from the flag when the catalog is loaded.
+	Colors []FlagColor `json:"colors,omitempty"`
+}
+
+// FlagURL returns the path the country's flag is served from.
+func (c *Country) FlagURL() string {
+	return "/static/svg/" + c.ISO2 + ".svg"
+}
+
+// FlagColor is a colour of a country's flag.
+type FlagColor struct {
+	Hex   string  `json:"hex"`   // "#rrggbb"
+	Name  string  `json:"name"`  // basic colour name, such as "red"
+	Share float64 `json:"share"` // share of the flag's area
+}
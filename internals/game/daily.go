@@ -0,0 +1,33 @@
+package game
+
+import "time"
+
+// DailyRun is a player's attempt at the daily challenge. Everyone is asked
+// the same questions on a given day, and each player may play them once.
+type DailyRun struct {
+	PlayerID    string     `json:"player_id"`
+	Username    string     `json:"username"`
+	Date        string     `json:"date"`    // UTC day of the challenge, as 2006-01-02
+	Results     []bool     `json:"results"` // whether each answered question was right
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Correct returns the number of questions answered correctly so far.
+func (r *DailyRun) Correct() int {
+	correct := 0
+	for _, ok := range r.Results {
+		if ok {
+			correct++
+		}
+	}
+	return correct
+}
+
+// Duration returns how long a completed run took.
+func (r *DailyRun) Duration() time.Duration {
+	if r.CompletedAt == nil {
+		return 0
+	}
+	return r.CompletedAt.Sub(r.StartedAt)
+}
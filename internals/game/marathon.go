@@ -0,0 +1,31 @@
+package game
+
+import "time"
+
+// MarathonRun is a single-player run over every flag in the catalog, or
+// every flag of a region. Runs are checkpointed after each answer so they
+// can be paused and resumed.
+type MarathonRun struct {
+	ID          string       `json:"id"`
+	PlayerID    string       `json:"player_id,omitempty"` // guest identity that started the run
+	Region      string       `json:"region,omitempty"`
+	Questions   []Question   `json:"questions"`
+	Index       int          `json:"index"` // next question to answer
+	Correct     int          `json:"correct"`
+	Missed      []MissedFlag `json:"missed"`
+	StartedAt   time.Time    `json:"started_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+}
+
+// MissedFlag records a flag answered wrongly during a marathon.
+type MissedFlag struct {
+	FlagURL      string `json:"flag_url"`
+	Country      string `json:"country"`
+	ChosenAnswer string `json:"chosen_answer"`
+}
+
+// Completed reports whether every question of the run has been answered.
+func (r *MarathonRun) Completed() bool {
+	return r.Index >= len(r.Questions)
+}
@@ -2,22 +2,48 @@ package game
 
 import (
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 type Question struct {
-	FlagURL string   `json:"flag_url"`
+	FlagURL string   `json:"flag_url,omitempty"`
+	Prompt  string   `json:"prompt,omitempty"`
 	Options []string `json:"options,omitempty"`
 	Answer  string   `json:"answer"`
+	Country string   `json:"country,omitempty"` // ISO2, set by practice and zoom questions
+	Seed    int64    `json:"seed,omitempty"`    // picks the area a zoom question reveals
 }
 
 type Player struct {
-	ID        string
-	Username  string
-	Score     int
-	Completed bool
-	Conn      *websocket.Conn
+	ID         string
+	ProfileID  string // stable identity across games, empty for unrated players
+	Username   string
+	Score      int
+	Streak     int // consecutive correct answers
+	BestStreak int
+	Completed  bool
+	Eliminated bool // knocked out of a survival game, still watching
+	Team       int  // 1-based team number, 0 in rooms without teams
+	Conn       *websocket.Conn
+
+	// How much of the current zoom question's flag the player has seen
+	RevealIndex int
+	RevealLevel int
+
+	// Countries of the player's neighbour chain, as ISO2 codes
+	Chain []string
+
+	// Answered holds the indexes of the questions the player has answered,
+	// each of which only scores once
+	Answered map[int]bool
+
+	// QuestionIndex is the question the player is currently on, shown to
+	// spectators
+	QuestionIndex int
+
+	writeMu sync.Mutex
 }
 
 type GameState struct {
@@ -26,17 +52,107 @@ type GameState struct {
 }
 
 type Room struct {
+	// Mutex guards Players and Spectators, which each connection adds
+	// itself to and removes itself from while others read them, and
+	// Starting, so that only one countdown is ever run.
+	sync.Mutex
+
 	Code      string
 	Hostname  string
 	Players   map[*websocket.Conn]*Player
 	Questions map[string]*Question
 	Start     bool
-	TimeLimit int // in seconds
+	Starting  bool // set once the countdown begins
+	TimeLimit int  // in minutes
 	GameMode  string
+
+	// QuestionTimeLimit is the time allowed per question in seconds.
+	// Zero disables the per-question timer.
+	QuestionTimeLimit int
+	Finished          bool
+
+	// Contestants is the number of players when the game started and
+	// Winner is the username of the last player standing in survival games.
+	Contestants int
+	Winner      string
+
+	// Teams is the number of teams players are split into, 0 for rooms
+	// where everyone plays for themselves.
+	Teams int
+
+	// Region is where the room's players are from, as chosen for quick
+	// matches. Empty for rooms without one.
+	Region string
+
+	// Public rooms are listed in the lobby; private rooms can only be
+	// joined with their code.
+	Public bool
+
+	// PasswordHash and PasswordSalt protect rooms created with a password.
+	// Both are empty for rooms anyone with the code can join.
+	PasswordHash []byte
+	PasswordSalt []byte
+
+	// Spectators watch the game without playing. They receive every room
+	// broadcast but are not counted as players.
+	Spectators map[*websocket.Conn]*Player
+
+	// GameTimer ends the game when its time limit is up. It is stopped
+	// when the room closes early.
+	GameTimer *time.Timer
 }
 
 type CreateRoomRequest struct {
-	TimeLimit    int    `json:"timeLimit"`
-	NumQuestions int    `json:"numQuestions"`
-	GameType     string `json:"gameType"`
+	TimeLimit         int    `json:"timeLimit"`
+	NumQuestions      int    `json:"numQuestions"`
+	GameType          string `json:"gameType"`
+	QuestionTimeLimit int    `json:"questionTimeLimit,omitempty"`
+	Teams             int    `json:"teams,omitempty"`
+	Public            bool   `json:"public,omitempty"`
+	Password          string `json:"password,omitempty"`
+	Region            string `json:"region,omitempty"`
+}
+
+// Standing is a single player's placement in a finished game.
+type Standing struct {
+	Rank       int    `json:"rank"`
+	PlayerID   string `json:"player_id"`
+	Username   string `json:"username"`
+	Score      int    `json:"score"`
+	BestStreak int    `json:"best_streak"`
+	Completed  bool   `json:"completed"`
+	Eliminated bool   `json:"eliminated,omitempty"`
+	Team       int    `json:"team,omitempty"`
+
+	ProfileID string        `json:"profile_id,omitempty"`
+	Rating    *RatingChange `json:"rating,omitempty"` // set for rated players
+}
+
+// RatingChange is how a game moved a player's rating.
+type RatingChange struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
+	Change int `json:"change"`
+}
+
+// TeamStanding is a team's placement, scoring the sum of its members' scores.
+type TeamStanding struct {
+	Rank    int      `json:"rank"`
+	Team    int      `json:"team"`
+	Name    string   `json:"name"`
+	Score   int      `json:"score"`
+	Members []string `json:"members"` // usernames
+}
+
+// Result is the final outcome of a multiplayer room.
+type Result struct {
+	RoomCode     string         `json:"room_code"`
+	GameMode     string         `json:"game_mode"`
+	Region       string         `json:"region,omitempty"`
+	NumQuestions int            `json:"num_questions"`
+	Standings    []Standing     `json:"standings"`
+	Teams        []TeamStanding `json:"teams,omitempty"`
+	Winner       string         `json:"winner,omitempty"`
+	Reason       string         `json:"reason"`
+	EndedAt      time.Time      `json:"ended_at"`
 }
@@ -0,0 +1,81 @@
+package game
+
+// Game types accepted by room creation and single-player.
+const (
+	// GameTypeMCQ shows a flag and asks for the country name.
+	GameTypeMCQ = "MCQ"
+	// GameTypeMap shows a flag and asks the player to find the country on the map.
+	GameTypeMap = "MAP"
+	// GameTypeCapital shows a flag and country name and asks for the capital.
+	GameTypeCapital = "CAPITAL"
+	// GameTypeCapitalToFlag shows a capital and asks for the flag of its country.
+	GameTypeCapitalToFlag = "CAPITAL_FLAG"
+	// GameTypeHigherLowerPopulation shows two flags and asks which country
+	// has the larger population. The run ends on the first miss.
+	GameTypeHigherLowerPopulation = "HIGHER_LOWER_POPULATION"
+	// GameTypeHigherLowerArea shows two flags and asks which country has the
+	// larger area. The run ends on the first miss.
+	GameTypeHigherLowerArea = "HIGHER_LOWER_AREA"
+	// GameTypeSurvival asks MCQ questions over the whole catalog without
+	// repeats. One wrong answer eliminates the player; in rooms the last
+	// player standing wins.
+	GameTypeSurvival = "SURVIVAL"
+	// GameTypeZoom shows a small fragment of a flag and asks for the country.
+	// More of the flag is revealed over time or on request, for fewer points.
+	GameTypeZoom = "ZOOM"
+	// GameTypeSpotReal shows a country name and asks the player to pick its
+	// real flag among generated fakes.
+	GameTypeSpotReal = "SPOT_REAL"
+	// GameTypeColors shows a country name and asks which set of colours
+	// appears on its flag.
+	GameTypeColors = "COLORS"
+	// GameTypeNeighbourChain starts from a country and asks the player to
+	// name a country bordering the previous answer, building a chain across
+	// the map. The run ends on the first invalid link.
+	GameTypeNeighbourChain = "NEIGHBOUR_CHAIN"
+	// GameTypePractice serves MCQ questions on the flags a player is due to
+	// review or weakest on. It is single-player only.
+	GameTypePractice = "PRACTICE"
+	// GameTypeDaily serves the daily challenge, the same MCQ questions for
+	// every player on a given day. It is single-player only and can be
+	// played once a day.
+	GameTypeDaily = "DAILY"
+)
+
+// IsValidGameType reports whether gameType is one of the supported game types.
+func IsValidGameType(gameType string) bool {
+	switch gameType {
+	case GameTypeMCQ, GameTypeMap, GameTypeCapital, GameTypeCapitalToFlag,
+		GameTypeHigherLowerPopulation, GameTypeHigherLowerArea, GameTypeSurvival,
+		GameTypeZoom, GameTypeSpotReal, GameTypeColors, GameTypeNeighbourChain:
+		return true
+	}
+	return false
+}
+
+// HasOptions reports whether questions of gameType are answered by picking
+// one of several options.
+func HasOptions(gameType string) bool {
+	return gameType != GameTypeMap && gameType != GameTypeNeighbourChain
+}
+
+// IsStreakMode reports whether a run of gameType ends on the first wrong answer.
+func IsStreakMode(gameType string) bool {
+	switch gameType {
+	case GameTypeHigherLowerPopulation, GameTypeHigherLowerArea, GameTypeSurvival:
+		return true
+	}
+	return false
+}
+
+// UsesWholeCatalog reports whether games of gameType ask about every
+// country rather than a requested number of questions.
+func UsesWholeCatalog(gameType string) bool {
+	return gameType == GameTypeSurvival
+}
+
+// HasQuestionCount reports whether games of gameType ask a requested number
+// of questions.
+func HasQuestionCount(gameType string) bool {
+	return !UsesWholeCatalog(gameType) && gameType != GameTypeNeighbourChain
+}
@@ -1 +1,10 @@
 package game
+
+// Send writes a JSON message to the player's connection. Writes are
+// serialised because a websocket connection supports only one concurrent
+// writer, and rooms write to a player from several goroutines.
+func (p *Player) Send(message interface{}) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return p.Conn.WriteJSON(message)
+}
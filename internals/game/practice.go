@@ -0,0 +1,97 @@
+package game
+
+import (
+	"math"
+	"time"
+)
+
+// SM-2 parameters. Answers are graded from 0 (blackout) to 5 (perfect);
+// grades below 3 count as a lapse and restart the card.
+const (
+	initialEase  = 2.5
+	minimumEase  = 1.3
+	passingGrade = 3
+	masteredDays = 21
+)
+
+// Mastery levels reported for a practice card.
+const (
+	MasteryNew       = "new"
+	MasteryLearning  = "learning"
+	MasteryReviewing = "reviewing"
+	MasteryMastered  = "mastered"
+)
+
+// PracticeCard is a player's review history for a single country.
+type PracticeCard struct {
+	Country      string    `json:"country"` // ISO2
+	Attempts     int       `json:"attempts"`
+	Correct      int       `json:"correct"`
+	Repetitions  int       `json:"repetitions"` // consecutive passing reviews
+	Ease         float64   `json:"ease"`
+	IntervalDays int       `json:"interval_days"`
+	Due          time.Time `json:"due"`
+	LastReviewed time.Time `json:"last_reviewed"`
+}
+
+// NewPracticeCard returns a card for a country the player has never seen.
+func NewPracticeCard(country string) *PracticeCard {
+	return &PracticeCard{Country: country, Ease: initialEase}
+}
+
+// Review records an answer graded 0-5 at time now and schedules the next
+// review using the SM-2 algorithm.
+func (c *PracticeCard) Review(grade int, now time.Time) {
+	grade = max(0, min(5, grade))
+
+	c.Attempts++
+	if grade >= passingGrade {
+		c.Correct++
+		switch c.Repetitions {
+		case 0:
+			c.IntervalDays = 1
+		case 1:
+			c.IntervalDays = 6
+		default:
+			c.IntervalDays = int(math.Round(float64(c.IntervalDays) * c.Ease))
+		}
+		c.Repetitions++
+	} else {
+		// A lapse brings the card back in the same session
+		c.Repetitions = 0
+		c.IntervalDays = 0
+	}
+
+	miss := float64(5 - grade)
+	c.Ease = max(minimumEase, c.Ease+0.1-miss*(0.08+miss*0.02))
+
+	c.LastReviewed = now
+	c.Due = now.AddDate(0, 0, c.IntervalDays)
+}
+
+// IsDue reports whether the card should be reviewed at time now.
+func (c *PracticeCard) IsDue(now time.Time) bool {
+	return c.Attempts > 0 && !c.Due.After(now)
+}
+
+// Accuracy is the share of correct answers, 0 for an unseen card.
+func (c *PracticeCard) Accuracy() float64 {
+	if c.Attempts == 0 {
+		return 0
+	}
+	return float64(c.Correct) / float64(c.Attempts)
+}
+
+// Mastery summarises how well the player knows the card.
+func (c *PracticeCard) Mastery() string {
+	switch {
+	case c.Attempts == 0:
+		return MasteryNew
+	case c.IntervalDays >= masteredDays:
+		return MasteryMastered
+	case c.Repetitions >= 2:
+		return MasteryReviewing
+	default:
+		return MasteryLearning
+	}
+}
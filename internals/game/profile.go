@@ -0,0 +1,23 @@
+package game
+
+import "time"
+
+// Profile is a player's persistent record across multiplayer games.
+type Profile struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"` // name of the player's latest game
+	Rating    int       `json:"rating"`
+	Games     int       `json:"games"` // rated games played
+	Wins      int       `json:"wins"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewProfile returns the profile of a player who has not played a rated game.
+func NewProfile(id string) *Profile {
+	return &Profile{ID: id, Rating: DefaultRating}
+}
+
+// Provisional reports whether the player's rating is still settling.
+func (p *Profile) Provisional() bool {
+	return p.Games < ProvisionalGames
+}
@@ -0,0 +1,67 @@
+package game
+
+import "math"
+
+// DefaultRating is the Elo rating new players start from.
+const DefaultRating = 1200
+
+// Players are provisional for their first ProvisionalGames rated games,
+// during which their rating moves faster.
+const (
+	ProvisionalGames = 10
+	provisionalK     = 40
+	establishedK     = 20
+)
+
+// Placement is a participant of a rated game.
+type Placement struct {
+	Rating int
+	Games  int // rated games played before this one
+	Rank   int // 1 is first place, equal ranks are draws
+}
+
+// UpdateRatings returns the rating changes of the participants of a game.
+// A game with n players is scored as every pair of players playing each
+// other: the higher placed player wins and equal placements draw. Each
+// player's change is the usual Elo update over those pairings, with the
+// K-factor split between them so that a game is worth the same however
+// many players take part.
+func UpdateRatings(players []Placement) []int {
+	changes := make([]int, len(players))
+	if len(players) < 2 {
+		return changes
+	}
+
+	for i, player := range players {
+		var delta float64
+		for j, opponent := range players {
+			if i == j {
+				continue
+			}
+			delta += pairScore(player.Rank, opponent.Rank) - expectedScore(player.Rating, opponent.Rating)
+		}
+
+		k := float64(establishedK)
+		if player.Games < ProvisionalGames {
+			k = provisionalK
+		}
+		changes[i] = int(math.Round(k * delta / float64(len(players)-1)))
+	}
+	return changes
+}
+
+// expectedScore is the chance of a player rated a beating one rated b.
+func expectedScore(a, b int) float64 {
+	return 1 / (1 + math.Pow(10, float64(b-a)/400))
+}
+
+func pairScore(rank, opponentRank int) float64 {
+	switch {
+	case rank < opponentRank:
+		return 1
+	case rank > opponentRank:
+		return 0
+	default:
+		return 0.5
+	}
+}
@@ -0,0 +1,149 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpdateRatings(t *testing.T) {
+	tests := []struct {
+		name    string
+		players []Placement
+		want    []int
+	}{
+		{
+			name:    "no players",
+			players: []Placement{},
+			want:    []int{},
+		},
+		{
+			name:    "single player",
+			players: []Placement{{Rating: 1500, Games: 3, Rank: 1}},
+			want:    []int{0},
+		},
+		{
+			name: "established win between equals",
+			players: []Placement{
+				{Rating: 1200, Games: 20, Rank: 1},
+				{Rating: 1200, Games: 20, Rank: 2},
+			},
+			want: []int{10, -10},
+		},
+		{
+			name: "provisional win between equals",
+			players: []Placement{
+				{Rating: 1200, Games: 0, Rank: 1},
+				{Rating: 1200, Games: ProvisionalGames - 1, Rank: 2},
+			},
+			want: []int{20, -20},
+		},
+		{
+			name: "provisional and established K",
+			players: []Placement{
+				{Rating: 1200, Games: 2, Rank: 1},
+				{Rating: 1200, Games: ProvisionalGames, Rank: 2},
+			},
+			want: []int{20, -10},
+		},
+		{
+			name: "upset",
+			players: []Placement{
+				{Rating: 1200, Games: 20, Rank: 1},
+				{Rating: 1400, Games: 20, Rank: 2},
+			},
+			want: []int{15, -15},
+		},
+		{
+			name: "tie between equals",
+			players: []Placement{
+				{Rating: 1200, Games: 20, Rank: 1},
+				{Rating: 1200, Games: 20, Rank: 1},
+			},
+			want: []int{0, 0},
+		},
+		{
+			name: "tie moves ratings together",
+			players: []Placement{
+				{Rating: 1400, Games: 20, Rank: 1},
+				{Rating: 1200, Games: 20, Rank: 1},
+			},
+			want: []int{-5, 5},
+		},
+		{
+			name: "four players in order",
+			players: []Placement{
+				{Rating: 1200, Games: 20, Rank: 1},
+				{Rating: 1200, Games: 20, Rank: 2},
+				{Rating: 1200, Games: 20, Rank: 3},
+				{Rating: 1200, Games: 20, Rank: 4},
+			},
+			want: []int{10, 3, -3, -10},
+		},
+		{
+			name: "four players with a shared place",
+			players: []Placement{
+				{Rating: 1200, Games: 20, Rank: 2},
+				{Rating: 1200, Games: 20, Rank: 1},
+				{Rating: 1200, Games: 20, Rank: 2},
+				{Rating: 1200, Games: 20, Rank: 4},
+			},
+			want: []int{0, 10, 0, -10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := UpdateRatings(tt.players)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UpdateRatings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateRatingsTwoPlayerZeroSum(t *testing.T) {
+	ratings := []int{800, 1100, 1200, 1250, 1600, 2100}
+
+	for _, games := range []int{0, ProvisionalGames} {
+		for _, a := range ratings {
+			for _, b := range ratings {
+				for _, rank := range []int{1, 2} {
+					changes := UpdateRatings([]Placement{
+						{Rating: a, Games: games, Rank: 1},
+						{Rating: b, Games: games, Rank: rank},
+					})
+					if changes[0]+changes[1] != 0 {
+						t.Errorf("%d vs %d (rank %d, %d games): changes %v do not sum to zero",
+							a, b, rank, games, changes)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestUpdateRatingsOrdering(t *testing.T) {
+	players := []Placement{
+		{Rating: 1300, Games: 20, Rank: 3},
+		{Rating: 1100, Games: 20, Rank: 1},
+		{Rating: 1250, Games: 20, Rank: 5},
+		{Rating: 1200, Games: 20, Rank: 2},
+		{Rating: 1150, Games: 20, Rank: 4},
+	}
+	changes := UpdateRatings(players)
+
+	// Better placed players never gain less than worse placed ones when
+	// nobody is rated far above the rest
+	for i := range players {
+		for j := range players {
+			if players[i].Rank < players[j].Rank && changes[i] < changes[j] {
+				t.Errorf("rank %d changed by %d, less than rank %d's %d",
+					players[i].Rank, changes[i], players[j].Rank, changes[j])
+			}
+		}
+	}
+
+	if changes[1] <= 0 || changes[2] >= 0 {
+		t.Errorf("winner and last place changed by %d and %d", changes[1], changes[2])
+	}
+}
@@ -1 +1,20 @@
 package game
+
+import "time"
+
+// RoomSnapshot is the state of a room as persisted while it is open, so that
+// games interrupted by a crash or restart can still be accounted for.
+type RoomSnapshot struct {
+	Code              string     `json:"code"`
+	Host              string     `json:"host"`
+	GameMode          string     `json:"game_mode"`
+	Region            string     `json:"region,omitempty"`
+	NumQuestions      int        `json:"num_questions"`
+	TimeLimit         int        `json:"time_limit"` // in minutes
+	QuestionTimeLimit int        `json:"question_time_limit,omitempty"`
+	Teams             int        `json:"teams,omitempty"`
+	Public            bool       `json:"public,omitempty"`
+	Started           bool       `json:"started"`
+	Players           []Standing `json:"players"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
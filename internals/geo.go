@@ -0,0 +1,334 @@
+package internals
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxGeoTolerance bounds the simplification tolerance (in degrees) a client
+// may request. Anything coarser than this is no longer recognisable.
+const maxGeoTolerance = 1.0
+
+// maxGeoVariants bounds the number of rendered variants kept in memory.
+const maxGeoVariants = 64
+
+var errUnknownRegion = errors.New("unknown region")
+
+type geoFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []geoFeature `json:"features"`
+}
+
+type geoFeature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   geoGeometry            `json:"geometry"`
+}
+
+type geoGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// geoVariant is a rendered GeoJSON document ready to be written to clients.
+type geoVariant struct {
+	body    []byte
+	gzipped []byte
+	etag    string
+}
+
+var (
+	geoOnce     sync.Once
+	geoWorld    *geoFeatureCollection
+	geoLoadErr  error
+	geoMu       sync.Mutex
+	geoVariants = make(map[string]*geoVariant)
+)
+
+// loadGeo parses the bundled world GeoJSON once.
+func loadGeo() (*geoFeatureCollection, error) {
+	geoOnce.Do(func() {
+		data, err := readAsset("frontend/static/countries.geo.json")
+		if err != nil {
+			geoLoadErr = err
+			return
+		}
+
+		var world geoFeatureCollection
+		if err := json.Unmarshal(data, &world); err != nil {
+			geoLoadErr = fmt.Errorf("parse countries.geo.json: %w", err)
+			return
+		}
+
+		geoWorld = &world
+	})
+	return geoWorld, geoLoadErr
+}
+
+// geoHandler serves the world GeoJSON used by the map game.
+//
+// HTTP Method: GET
+// Query Parameters:
+//   - tolerance: Optional Douglas–Peucker tolerance in degrees (0 to 1).
+//     Omit or pass 0 for the full resolution file.
+//   - region: Optional region name (Africa, Americas, Asia, Europe, Oceania)
+//     restricting the response to countries of that region. Regions are
+//     the continents of data/countries.json, so map features that are not
+//     in the catalog only appear on the whole world map.
+//
+// Responses carry an ETag and are gzip encoded when the client accepts it.
+//
+// Response:
+//   - 200: GeoJSON feature collection
+//   - 304: Client copy is up to date
+//   - 400: Invalid tolerance or unknown region
+//   - 500: GeoJSON could not be loaded
+func geoHandler(w http.ResponseWriter, r *http.Request) {
+	tolerance := 0.0
+	if raw := r.URL.Query().Get("tolerance"); raw != "" {
+		t, err := strconv.ParseFloat(raw, 64)
+		if err != nil || t < 0 || t > maxGeoTolerance {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{
+				Error: fmt.Sprintf("tolerance must be a number between 0 and %g", maxGeoTolerance),
+			})
+			return
+		}
+		// Quantise so that near-identical requests share a cached variant
+		tolerance = math.Round(t*1000) / 1000
+	}
+
+	region := r.URL.Query().Get("region")
+
+	variant, err := getGeoVariant(tolerance, region)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == errUnknownRegion {
+			status = http.StatusBadRequest
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	body := variant.body
+	etag := variant.etag
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		body = variant.gzipped
+		etag = strings.TrimSuffix(etag, `"`) + `-gz"`
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+
+	w.Header().Set("Vary", "Accept-Encoding")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+
+	if match := r.Header.Get("If-None-Match"); match != "" && match == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
+
+// getGeoVariant returns the rendered GeoJSON for a tolerance and region,
+// building and caching it on first use.
+func getGeoVariant(tolerance float64, region string) (*geoVariant, error) {
+	world, err := loadGeo()
+	if err != nil {
+		return nil, err
+	}
+	countries, err := getCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	key := strconv.FormatFloat(tolerance, 'f', 3, 64) + "/" + strings.ToLower(region)
+
+	geoMu.Lock()
+	defer geoMu.Unlock()
+
+	if variant, ok := geoVariants[key]; ok {
+		return variant, nil
+	}
+
+	features := world.Features
+	if region != "" {
+		features = nil
+		for _, feature := range world.Features {
+			if country, ok := countries.byISO3[feature.ID]; ok && strings.EqualFold(country.Continent, region) {
+				features = append(features, feature)
+			}
+		}
+		if len(features) == 0 {
+			return nil, errUnknownRegion
+		}
+	}
+
+	if tolerance > 0 {
+		simplified := make([]geoFeature, 0, len(features))
+		for _, feature := range features {
+			feature.Geometry, err = simplifyGeometry(feature.Geometry, tolerance)
+			if err != nil {
+				return nil, fmt.Errorf("simplify %s: %w", feature.ID, err)
+			}
+			simplified = append(simplified, feature)
+		}
+		features = simplified
+	}
+
+	body, err := json.Marshal(geoFeatureCollection{Type: world.Type, Features: features})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	gz, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	gz.Write(body)
+	gz.Close()
+
+	sum := sha256.Sum256(body)
+	variant := &geoVariant{
+		body:    body,
+		gzipped: buf.Bytes(),
+		etag:    `"` + hex.EncodeToString(sum[:12]) + `"`,
+	}
+
+	// The variant space is small, so dropping everything when full is
+	// simpler than tracking recency
+	if len(geoVariants) >= maxGeoVariants {
+		geoVariants = make(map[string]*geoVariant)
+	}
+	geoVariants[key] = variant
+
+	return variant, nil
+}
+
+// simplifyGeometry applies Douglas–Peucker simplification to every ring of
+// a Polygon or MultiPolygon geometry.
+func simplifyGeometry(geometry geoGeometry, tolerance float64) (geoGeometry, error) {
+	var coordinates interface{}
+
+	switch geometry.Type {
+	case "Polygon":
+		var polygon [][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &polygon); err != nil {
+			return geometry, err
+		}
+		coordinates = simplifyPolygon(polygon, tolerance)
+
+	case "MultiPolygon":
+		var multi [][][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &multi); err != nil {
+			return geometry, err
+		}
+		for i, polygon := range multi {
+			multi[i] = simplifyPolygon(polygon, tolerance)
+		}
+		coordinates = multi
+
+	default:
+		return geometry, nil
+	}
+
+	raw, err := json.Marshal(coordinates)
+	if err != nil {
+		return geometry, err
+	}
+	return geoGeometry{Type: geometry.Type, Coordinates: raw}, nil
+}
+
+// simplifyPolygon simplifies each ring of a polygon. Rings that would
+// collapse below a valid closed ring are kept at full resolution.
+// Coordinates are also rounded to one decimal place finer than the
+// tolerance, since the extra digits only add to the payload.
+func simplifyPolygon(polygon [][][]float64, tolerance float64) [][][]float64 {
+	scale := math.Pow(10, math.Ceil(-math.Log10(tolerance))+1)
+
+	out := make([][][]float64, 0, len(polygon))
+	for _, ring := range polygon {
+		simplified := douglasPeucker(ring, tolerance)
+		if len(simplified) < 4 {
+			simplified = ring
+		}
+
+		rounded := make([][]float64, len(simplified))
+		for i, point := range simplified {
+			rounded[i] = []float64{math.Round(point[0]*scale) / scale, math.Round(point[1]*scale) / scale}
+		}
+		out = append(out, rounded)
+	}
+	return out
+}
+
+// douglasPeucker reduces a line to the points that deviate from the
+// straight segment between its ends by more than tolerance.
+func douglasPeucker(points [][]float64, tolerance float64) [][]float64 {
+	if len(points) < 3 {
+		return points
+	}
+
+	keep := make([]bool, len(points))
+	keep[0] = true
+	keep[len(points)-1] = true
+
+	// Iterative rather than recursive to cope with very long coastlines
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		first, last := span[0], span[1]
+		maxDistance := 0.0
+		index := -1
+		for i := first + 1; i < last; i++ {
+			d := perpendicularDistance(points[i], points[first], points[last])
+			if d > maxDistance {
+				maxDistance = d
+				index = i
+			}
+		}
+
+		if index != -1 && maxDistance > tolerance {
+			keep[index] = true
+			stack = append(stack, [2]int{first, index}, [2]int{index, last})
+		}
+	}
+
+	out := make([][]float64, 0, len(points))
+	for i, point := range points {
+		if keep[i] {
+			out = append(out, point)
+		}
+	}
+	return out
+}
+
+// perpendicularDistance returns the distance from p to the segment a-b.
+func perpendicularDistance(p, a, b []float64) float64 {
+	dx := b[0] - a[0]
+	dy := b[1] - a[1]
+
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
+}
@@ -0,0 +1,55 @@
+package internals
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDouglasPeucker(t *testing.T) {
+	tests := []struct {
+		name      string
+		points    [][]float64
+		tolerance float64
+		want      [][]float64
+	}{
+		{
+			name:      "polyline",
+			points:    [][]float64{{0, 0}, {1, 0.1}, {2, -0.1}, {3, 5}, {4, 6}, {5, 7}, {6, 8.1}, {7, 9}, {8, 9}, {9, 9}},
+			tolerance: 1,
+			want:      [][]float64{{0, 0}, {2, -0.1}, {3, 5}, {7, 9}, {9, 9}},
+		},
+		{
+			name:      "zero tolerance keeps every bend",
+			points:    [][]float64{{0, 0}, {1, 0.1}, {2, 0}},
+			tolerance: 0,
+			want:      [][]float64{{0, 0}, {1, 0.1}, {2, 0}},
+		},
+		{
+			name:      "two points",
+			points:    [][]float64{{0, 0}, {5, 5}},
+			tolerance: 1,
+			want:      [][]float64{{0, 0}, {5, 5}},
+		},
+		{
+			name:      "collinear",
+			points:    [][]float64{{0, 0}, {1, 1}, {2, 2}, {3, 3}, {4, 4}},
+			tolerance: 0.1,
+			want:      [][]float64{{0, 0}, {4, 4}},
+		},
+		{
+			// The ends of a ring meet, so points are measured from them
+			name:      "closed ring",
+			points:    [][]float64{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}},
+			tolerance: 0.5,
+			want:      [][]float64{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := douglasPeucker(test.points, test.tolerance); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("douglasPeucker(%v, %v) = %v, want %v", test.points, test.tolerance, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package internals
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// higherLowerBands are the ranges of the larger/smaller value ratio used as
+// a run progresses. Early pairs are far apart and easy to tell; later pairs
+// are close together.
+var higherLowerBands = []struct {
+	min, max float64
+}{
+	{4, math.Inf(1)},
+	{2, 4},
+	{1.4, 2},
+	{1, 1.4},
+}
+
+// maxPairAttempts bounds the random pairs tried when looking for one that
+// fits the current difficulty band.
+const maxPairAttempts = 200
+
+// errNoHigherLowerPair is returned when no two countries with different
+// values can be found to compare.
+var errNoHigherLowerPair = errors.New("no two countries with different values to compare")
+
+// generateHigherLowerQuestions builds pairs of countries for the
+// higher/lower modes. Each question's options are the two flag URLs and
+// the answer is the flag of the country with the larger population or area.
+// Pairs get harder over the run by moving through higherLowerBands.
+func generateHigherLowerQuestions(c *catalog, numQuestions int, gameType string, rng *rand.Rand) ([]game.Question, error) {
+	metric := func(country *game.Country) float64 { return float64(country.Population) }
+	prompt := "Which country has the larger population?"
+	if gameType == game.GameTypeHigherLowerArea {
+		metric = func(country *game.Country) float64 { return country.Area }
+		prompt = "Which country has the larger area?"
+	}
+
+	var candidates []*game.Country
+	for i := range c.countries {
+		if metric(&c.countries[i]) > 0 {
+			candidates = append(candidates, &c.countries[i])
+		}
+	}
+
+	if len(candidates) < 2 {
+		return nil, errNoHigherLowerPair
+	}
+
+	used := make(map[string]bool)
+	questions := make([]game.Question, 0, numQuestions)
+
+	for i := 0; i < numQuestions; i++ {
+		band := higherLowerBands[i*len(higherLowerBands)/numQuestions]
+		a, b, err := pickPair(candidates, metric, band.min, band.max, used, rng)
+		if err != nil {
+			return nil, err
+		}
+		used[a.ISO2] = true
+		used[b.ISO2] = true
+
+		// Once every country has been shown, allow repeats rather than
+		// cutting the run short
+		if len(used) >= len(candidates)-1 {
+			used = make(map[string]bool)
+		}
+
+		answer := a
+		if metric(b) > metric(a) {
+			answer = b
+		}
+
+		options := []string{a.FlagURL(), b.FlagURL()}
+		shuffleOptions(options, rng)
+
+		questions = append(questions, game.Question{
+			Prompt:  prompt,
+			Options: options,
+			Answer:  answer.FlagURL(),
+		})
+	}
+
+	return questions, nil
+}
+
+// pickPair returns two distinct unused countries whose metric ratio lies in
+// [minRatio, maxRatio). Countries with identical values are never paired. If
+// no pair fits after maxPairAttempts, the closest one found is returned, and
+// if every attempt hit a used country, any two countries with different
+// values. errNoHigherLowerPair is returned when none turn up either.
+func pickPair(candidates []*game.Country, metric func(*game.Country) float64, minRatio, maxRatio float64, used map[string]bool, rng *rand.Rand) (*game.Country, *game.Country, error) {
+	var bestA, bestB *game.Country
+	bestMiss := math.Inf(1)
+
+	for attempt := 0; attempt < maxPairAttempts; attempt++ {
+		a := candidates[rng.Intn(len(candidates))]
+		b := candidates[rng.Intn(len(candidates))]
+		if a == b || used[a.ISO2] || used[b.ISO2] || metric(a) == metric(b) {
+			continue
+		}
+
+		ratio := math.Max(metric(a), metric(b)) / math.Min(metric(a), metric(b))
+		if ratio >= minRatio && ratio < maxRatio {
+			return a, b, nil
+		}
+
+		miss := math.Min(math.Abs(ratio-minRatio), math.Abs(ratio-maxRatio))
+		if miss < bestMiss {
+			bestA, bestB, bestMiss = a, b, miss
+		}
+	}
+
+	if bestA != nil {
+		return bestA, bestB, nil
+	}
+
+	// Every attempt hit a used country; ignore usage for this pair
+	for attempt := 0; attempt < maxPairAttempts; attempt++ {
+		a := candidates[rng.Intn(len(candidates))]
+		b := candidates[rng.Intn(len(candidates))]
+		if a != b && metric(a) != metric(b) {
+			return a, b, nil
+		}
+	}
+	return nil, nil, errNoHigherLowerPair
+}
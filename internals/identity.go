@@ -0,0 +1,269 @@
+package internals
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// identityCookie is the name of the cookie holding a player's guest identity.
+const identityCookie = "fwf_guest"
+
+// identityTokenHeader carries a guest identity token, as returned by
+// identityHandler, for clients that do not keep cookies.
+const identityTokenHeader = "X-Identity-Token"
+
+// identityMaxAge is how long a guest identity cookie lasts. It is renewed
+// whenever the display name changes.
+const identityMaxAge = 365 * 24 * time.Hour
+
+// serverSecret signs guest identity cookies and seeds anything else that
+// has to be unpredictable yet stable across restarts.
+var serverSecret []byte
+
+// LoadSecret reads the server secret from path, creating the file with a
+// new random secret if it does not exist. An empty path uses a random
+// secret that only lasts until the server stops, logging everyone out on
+// every restart.
+func LoadSecret(path string) error {
+	if path == "" {
+		serverSecret = make([]byte, 32)
+		_, err := rand.Read(serverSecret)
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(secret) < 32 {
+			return errors.New("secret file must hold at least 32 hex-encoded bytes")
+		}
+		serverSecret = secret
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(secret)+"\n"), 0o600); err != nil {
+		return err
+	}
+
+	log.Printf("Created server secret %s", path)
+	serverSecret = secret
+	return nil
+}
+
+// guestIdentity is the stable identity of a player, carried in a signed
+// cookie so that no account is needed.
+type guestIdentity struct {
+	ID       string `json:"id"`
+	Username string `json:"username,omitempty"`
+
+	// issued is set when the identity was created for the current request
+	// because it came without a valid cookie.
+	issued bool
+}
+
+type identityKey struct{}
+
+func signIdentity(payload []byte) []byte {
+	mac := hmac.New(sha256.New, serverSecret)
+	mac.Write([]byte(identityCookie))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// encodeIdentity formats an identity as "payload.signature", both base64.
+func encodeIdentity(identity guestIdentity) string {
+	payload, _ := json.Marshal(identity)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signIdentity(payload))
+}
+
+// decodeIdentity parses a cookie value, rejecting it unless the signature
+// and identity are valid.
+func decodeIdentity(value string) (guestIdentity, bool) {
+	var identity guestIdentity
+
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return identity, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return identity, false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, signIdentity(payload)) {
+		return identity, false
+	}
+
+	if err := json.Unmarshal(payload, &identity); err != nil || !playerIDPattern.MatchString(identity.ID) {
+		return identity, false
+	}
+	return identity, true
+}
+
+func setIdentityCookie(w http.ResponseWriter, r *http.Request, identity guestIdentity) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     identityCookie,
+		Value:    encodeIdentity(identity),
+		Path:     "/",
+		MaxAge:   int(identityMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func newGuestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Printf("Failed to generate guest ID: %v", err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// identityMiddleware attaches the guest identity of the request's cookie,
+// or of its identity token header, to its context. Visitors with neither
+// are issued a new identity.
+func identityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var identity guestIdentity
+		var ok bool
+		if cookie, err := r.Cookie(identityCookie); err == nil {
+			identity, ok = decodeIdentity(cookie.Value)
+		}
+		if token := r.Header.Get(identityTokenHeader); !ok && token != "" {
+			identity, ok = decodeIdentity(token)
+		}
+
+		if !ok {
+			identity = guestIdentity{ID: newGuestID(), issued: true}
+			setIdentityCookie(w, r, identity)
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+	})
+}
+
+// requestIdentity returns the guest identity of a request.
+func requestIdentity(r *http.Request) guestIdentity {
+	identity, _ := r.Context().Value(identityKey{}).(guestIdentity)
+	return identity
+}
+
+// requestPlayerID returns the stable ID of the player making a request.
+// Only signed identities are trusted, never an ID the client names itself.
+func requestPlayerID(r *http.Request) string {
+	return requestIdentity(r).ID
+}
+
+// socketIdentity returns the identity of a WebSocket client. Clients that
+// do not keep cookies can send the token of their identity in their first
+// message instead.
+func socketIdentity(r *http.Request, token string) guestIdentity {
+	identity := requestIdentity(r)
+	if identity.issued && token != "" {
+		if tokenIdentity, ok := decodeIdentity(token); ok {
+			return tokenIdentity
+		}
+	}
+	return identity
+}
+
+// publicPlayerID returns the handle a player is shown under on public
+// lists. It is a keyed hash of their ID, so it tells players apart without
+// giving away the ID itself.
+func publicPlayerID(id string) string {
+	mac := hmac.New(sha256.New, serverSecret)
+	mac.Write([]byte("player:" + id))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// upgradeHeader returns the identity cookie issued for a request, to be
+// passed to the WebSocket upgrade: the 101 response does not include the
+// headers already set on w.
+func upgradeHeader(w http.ResponseWriter) http.Header {
+	cookies := w.Header().Values("Set-Cookie")
+	if len(cookies) == 0 {
+		return nil
+	}
+	return http.Header{"Set-Cookie": cookies}
+}
+
+// rememberUsername stores the display name a player last used in their
+// identity cookie.
+func rememberUsername(w http.ResponseWriter, r *http.Request, username string) {
+	identity := requestIdentity(r)
+	if identity.ID == "" || identity.Username == username {
+		return
+	}
+	identity.Username = username
+	setIdentityCookie(w, r, identity)
+}
+
+// identityHandler returns the guest identity of the caller, or changes the
+// display name remembered for them.
+//
+// HTTP Method: GET, POST
+// Content-Type: application/json
+//
+// Request Body (POST):
+//   - username: Display name to remember (4-20 characters)
+//
+// Response:
+//   - 200: The player's id, remembered username and token. Clients that do
+//     not keep cookies send the token in the X-Identity-Token header, or as
+//     "token" in the first WebSocket message.
+//   - 400: Invalid request
+func identityHandler(w http.ResponseWriter, r *http.Request) {
+	identity := requestIdentity(r)
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			Username string `json:"username"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON format"})
+			return
+		}
+		if len(req.Username) < 4 || len(req.Username) > 20 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "Username must be between 4 and 20 characters"})
+			return
+		}
+
+		rememberUsername(w, r, req.Username)
+		identity.Username = req.Username
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       identity.ID,
+		"username": identity.Username,
+		"token":    encodeIdentity(identity),
+	})
+}
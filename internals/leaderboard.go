@@ -0,0 +1,345 @@
+package internals
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+	"github.com/gorilla/mux"
+)
+
+// Leaderboard periods
+const (
+	periodAllTime = "all-time"
+	periodWeekly  = "weekly"
+	periodDaily   = "daily"
+)
+
+// Number of players listed on a leaderboard by default, and at most
+const (
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 100
+)
+
+// leaderboardKey identifies one leaderboard. Empty filters, and zero
+// questions, stand for every value, so each result is counted on the
+// boards of every combination of its filters.
+type leaderboardKey struct {
+	period    string
+	bucket    string // the week or day counted, empty for all-time
+	mode      string
+	region    string
+	questions int
+}
+
+// leaderboardEntry is a player's standing on a leaderboard. Players are
+// ranked by the total score of their games.
+type leaderboardEntry struct {
+	ProfileID string
+	Username  string
+	Score     int
+	Games     int
+	Wins      int
+	BestScore int
+}
+
+// leaderboard holds the entries of one board. ranked caches the entries in
+// order, and positions the index of each player in it; both are rebuilt
+// only after the board has changed.
+type leaderboard struct {
+	entries   map[string]*leaderboardEntry
+	ranked    []leaderboardEntry
+	positions map[string]int
+}
+
+var (
+	leaderboardsMu sync.Mutex
+	leaderboards   = make(map[leaderboardKey]*leaderboard)
+)
+
+// periodBucket returns the week or day of t counted by a period's boards.
+func periodBucket(period string, t time.Time) string {
+	t = t.UTC()
+	switch period {
+	case periodWeekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case periodDaily:
+		return t.Format("2006-01-02")
+	default:
+		return ""
+	}
+}
+
+// LoadLeaderboards builds the leaderboards from the results recorded so
+// far. Afterwards they are kept up to date as games finish.
+func LoadLeaderboards() (int, error) {
+	leaderboardsMu.Lock()
+	defer leaderboardsMu.Unlock()
+
+	leaderboards = make(map[leaderboardKey]*leaderboard)
+	count := 0
+	now := time.Now()
+	err := dataStore.EachResult(func(result game.Result) error {
+		addToLeaderboardsLocked(&result, now)
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// addToLeaderboards counts a finished game on every leaderboard it belongs
+// to.
+func addToLeaderboards(result *game.Result) {
+	leaderboardsMu.Lock()
+	defer leaderboardsMu.Unlock()
+	addToLeaderboardsLocked(result, time.Now())
+}
+
+func addToLeaderboardsLocked(result *game.Result, now time.Time) {
+	if !isRatedResult(result.Reason) {
+		return
+	}
+
+	// Weekly and daily boards only cover the current week and day; older
+	// ones are dropped as soon as a new one starts
+	for key := range leaderboards {
+		if key.bucket != "" && key.bucket != periodBucket(key.period, now) {
+			delete(leaderboards, key)
+		}
+	}
+
+	var periods []leaderboardKey
+	for _, period := range []string{periodAllTime, periodWeekly, periodDaily} {
+		bucket := periodBucket(period, result.EndedAt)
+		if bucket != periodBucket(period, now) {
+			continue
+		}
+		periods = append(periods, leaderboardKey{period: period, bucket: bucket})
+	}
+
+	ranks := placements(result)
+
+	// A profile playing from several connections counts once, with its
+	// best score
+	best := make(map[string]int)
+	var order []int
+	for i, standing := range result.Standings {
+		if standing.ProfileID == "" {
+			continue
+		}
+		j, seen := best[standing.ProfileID]
+		if !seen {
+			best[standing.ProfileID] = i
+			order = append(order, i)
+		} else if standing.Score > result.Standings[j].Score {
+			best[standing.ProfileID] = i
+		}
+	}
+
+	modes := []string{""}
+	if result.GameMode != "" {
+		modes = append(modes, result.GameMode)
+	}
+	regions := []string{""}
+	if result.Region != "" {
+		regions = append(regions, result.Region)
+	}
+	questionCounts := []int{0}
+	if result.NumQuestions > 0 {
+		questionCounts = append(questionCounts, result.NumQuestions)
+	}
+
+	for _, key := range periods {
+		for _, key.mode = range modes {
+			for _, key.region = range regions {
+				for _, key.questions = range questionCounts {
+					board := leaderboards[key]
+					if board == nil {
+						board = &leaderboard{entries: make(map[string]*leaderboardEntry)}
+						leaderboards[key] = board
+					}
+					for _, i := range order {
+						i = best[result.Standings[i].ProfileID]
+						board.add(result.Standings[i], ranks[i] == 1)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (b *leaderboard) add(standing game.Standing, won bool) {
+	entry := b.entries[standing.ProfileID]
+	if entry == nil {
+		entry = &leaderboardEntry{ProfileID: standing.ProfileID}
+		b.entries[standing.ProfileID] = entry
+	}
+
+	entry.Username = standing.Username
+	entry.Score += standing.Score
+	entry.Games++
+	if won {
+		entry.Wins++
+	}
+	if standing.Score > entry.BestScore {
+		entry.BestScore = standing.Score
+	}
+	b.ranked, b.positions = nil, nil
+}
+
+// rank returns the entries of the board in order: by total score, then
+// wins, then fewest games played.
+func (b *leaderboard) rank() ([]leaderboardEntry, map[string]int) {
+	if b.ranked != nil {
+		return b.ranked, b.positions
+	}
+
+	ranked := make([]leaderboardEntry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		ranked = append(ranked, *entry)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		if a.Games != b.Games {
+			return a.Games < b.Games
+		}
+		return a.ProfileID < b.ProfileID
+	})
+	positions := make(map[string]int, len(ranked))
+	for i, entry := range ranked {
+		positions[entry.ProfileID] = i
+	}
+	b.ranked, b.positions = ranked, positions
+	return ranked, positions
+}
+
+// entryView formats a leaderboard entry at a given rank.
+func entryView(entry leaderboardEntry, rank int) map[string]interface{} {
+	return map[string]interface{}{
+		"rank":       rank,
+		"player":     publicPlayerID(entry.ProfileID),
+		"username":   entry.Username,
+		"score":      entry.Score,
+		"games":      entry.Games,
+		"wins":       entry.Wins,
+		"best_score": entry.BestScore,
+	}
+}
+
+// parseLeaderboardKey reads the board requested by a leaderboard query.
+func parseLeaderboardKey(r *http.Request) (leaderboardKey, error) {
+	query := r.URL.Query()
+
+	period := mux.Vars(r)["period"]
+	if period == "" {
+		period = periodAllTime
+	}
+	key := leaderboardKey{
+		period: period,
+		bucket: periodBucket(period, time.Now()),
+		mode:   strings.ToUpper(query.Get("mode")),
+		region: strings.ToLower(strings.TrimSpace(query.Get("region"))),
+	}
+
+	if period != periodAllTime && period != periodWeekly && period != periodDaily {
+		return key, fmt.Errorf("unknown period %q", period)
+	}
+	if key.mode != "" && !game.IsValidGameType(key.mode) {
+		return key, fmt.Errorf("unknown game type %q", key.mode)
+	}
+	if len(key.region) > maxRegionLength {
+		return key, fmt.Errorf("region must be at most %d characters", maxRegionLength)
+	}
+	if q := query.Get("questions"); q != "" {
+		questions, err := strconv.Atoi(q)
+		if err != nil || questions <= 0 {
+			return key, fmt.Errorf("invalid question count %q", q)
+		}
+		key.questions = questions
+	}
+	return key, nil
+}
+
+// leaderboardHandler returns the top players of a leaderboard along with
+// the caller's own standing.
+//
+// HTTP Method: GET
+// Path Parameter:
+//   - period: "all-time" (the default), "weekly" or "daily"
+//
+// Query Parameters:
+//   - mode: Only count games of this game type
+//   - region: Only count games of this region
+//   - questions: Only count games with this many questions
+//   - limit: Number of players listed (default 10, at most 100)
+//
+// Response:
+//   - 200: The ranked players and the caller's entry, which is null if
+//     they have not played a counted game in the period
+//   - 400: Invalid parameters
+func leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := parseLeaderboardKey(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	limit := defaultLeaderboardLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > maxLeaderboardLimit {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: fmt.Sprintf("limit must be between 1 and %d", maxLeaderboardLimit)})
+			return
+		}
+	}
+
+	playerID := requestPlayerID(r)
+
+	leaderboardsMu.Lock()
+	var ranked []leaderboardEntry
+	var positions map[string]int
+	if board := leaderboards[key]; board != nil {
+		ranked, positions = board.rank()
+	}
+	leaderboardsMu.Unlock()
+
+	// Rankings are replaced rather than modified, so they can be read
+	// without the lock
+	entries := []map[string]interface{}{}
+	for i := 0; i < limit && i < len(ranked); i++ {
+		entries = append(entries, entryView(ranked[i], i+1))
+	}
+	var me map[string]interface{}
+	if i, ok := positions[playerID]; ok {
+		me = entryView(ranked[i], i+1)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"period":    key.period,
+		"bucket":    key.bucket,
+		"mode":      key.mode,
+		"region":    key.region,
+		"questions": key.questions,
+		"players":   len(ranked),
+		"entries":   entries,
+		"me":        me,
+	})
+}
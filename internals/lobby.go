@@ -0,0 +1,221 @@
+package internals
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// maxPlayers is the number of players a room holds.
+const maxPlayers = 9
+
+// lobbyHeartbeat is how often an idle lobby feed sends a comment, so that
+// proxies do not time the stream out.
+const lobbyHeartbeat = 30 * time.Second
+
+var (
+	lobbyMu          sync.Mutex
+	lobbySubscribers = make(map[chan struct{}]struct{})
+)
+
+// lobbyFilter selects the rooms shown in the lobby.
+type lobbyFilter struct {
+	mode     string // game type, empty for every mode
+	spectate bool   // also list games in progress, which can be watched
+}
+
+func parseLobbyFilter(r *http.Request) (lobbyFilter, error) {
+	filter := lobbyFilter{
+		mode:     strings.ToUpper(r.URL.Query().Get("mode")),
+		spectate: r.URL.Query().Get("spectate") == "true",
+	}
+	if filter.mode != "" && !game.IsValidGameType(filter.mode) {
+		return filter, fmt.Errorf("unknown game type %q", filter.mode)
+	}
+	return filter, nil
+}
+
+// roomState describes where a room is in its lifecycle.
+func roomState(room *game.Room) string {
+	switch {
+	case room.Finished:
+		return "finished"
+	case room.Start:
+		return "playing"
+	case playerCount(room) >= maxPlayers:
+		return "full"
+	default:
+		return "waiting"
+	}
+}
+
+// lobbyRooms returns the public rooms matching filter, sorted by code.
+// Rooms waiting for players are listed; games in progress are only listed
+// for spectators.
+func lobbyRooms(filter lobbyFilter) []map[string]interface{} {
+	list := []map[string]interface{}{}
+	for _, room := range snapshotRooms() {
+		if !room.Public {
+			continue
+		}
+		if filter.mode != "" && room.GameMode != filter.mode {
+			continue
+		}
+
+		state := roomState(room)
+		if state != "waiting" && !(filter.spectate && state == "playing") {
+			continue
+		}
+
+		list = append(list, map[string]interface{}{
+			"code":         room.Code,
+			"host":         room.Hostname,
+			"gamemode":     room.GameMode,
+			"state":        state,
+			"players":      playerCount(room),
+			"maxPlayers":   maxPlayers,
+			"spectators":   spectatorCount(room),
+			"hasPassword":  len(room.PasswordHash) > 0,
+			"timeLimit":    room.TimeLimit,
+			"numQuestions": len(room.Questions),
+
+			"questionTimeLimit": room.QuestionTimeLimit,
+			"teams":             room.Teams,
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i]["code"].(string) < list[j]["code"].(string)
+	})
+	return list
+}
+
+// notifyLobby tells every lobby feed that the list of rooms may have
+// changed. It never blocks: a feed that has not caught up with the last
+// notification yet picks up this change along with it.
+func notifyLobby() {
+	lobbyMu.Lock()
+	defer lobbyMu.Unlock()
+
+	for ch := range lobbySubscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func subscribeLobby() chan struct{} {
+	ch := make(chan struct{}, 1)
+	lobbyMu.Lock()
+	lobbySubscribers[ch] = struct{}{}
+	lobbyMu.Unlock()
+	return ch
+}
+
+func unsubscribeLobby(ch chan struct{}) {
+	lobbyMu.Lock()
+	delete(lobbySubscribers, ch)
+	lobbyMu.Unlock()
+}
+
+// lobbyHandler lists the public rooms that can be joined.
+//
+// HTTP Method: GET
+//
+// Query Parameters:
+//   - mode: Only list rooms of this game type
+//   - spectate: "true" to also list games in progress, which can be watched
+//
+// Response:
+//   - 200: The matching rooms with their mode, player count, settings and state
+//   - 400: Unknown game type
+func lobbyHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLobbyFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rooms": lobbyRooms(filter),
+	})
+}
+
+// lobbyEventsHandler streams the public room list as server-sent events.
+// The current list is sent straight away and again whenever a room is
+// created, closed, joined, left or started.
+//
+// HTTP Method: GET
+//
+// Query Parameters:
+//   - mode: Only list rooms of this game type
+//   - spectate: "true" to also list games in progress, which can be watched
+//
+// Response:
+//   - 200: A text/event-stream of "rooms" events, each with the full list
+//   - 400: Unknown game type
+//   - 500: Streaming is not supported
+func lobbyEventsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLobbyFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Streaming is not supported"})
+		return
+	}
+
+	updates := subscribeLobby()
+	defer unsubscribeLobby(updates)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	heartbeat := time.NewTicker(lobbyHeartbeat)
+	defer heartbeat.Stop()
+
+	var last []byte
+	for {
+		// Feeds end with the server so that shutdown is not held up
+		if shuttingDown.Load() {
+			return
+		}
+
+		data, err := json.Marshal(lobbyRooms(filter))
+		if err != nil {
+			return
+		}
+		if string(data) != string(last) {
+			fmt.Fprintf(w, "event: rooms\ndata: %s\n\n", data)
+			flusher.Flush()
+			last = data
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-updates:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package internals
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+	"github.com/gorilla/mux"
+)
+
+var marathonIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// marathonRunTTL is how long an idle marathon run is kept before it and its
+// checkpoint are deleted.
+const marathonRunTTL = 30 * 24 * time.Hour
+
+// Number of marathon runs kept per player, the oldest being dropped for a
+// new one, and in total
+const (
+	maxMarathonRunsPerPlayer = 3
+	maxMarathonRuns          = 10000
+)
+
+var (
+	marathonMu     sync.Mutex
+	marathonRuns   = make(map[string]*game.MarathonRun)
+	marathonLoaded bool
+)
+
+var (
+	errMarathonNotFound = errors.New("marathon run not found")
+	errMarathonLimit    = errors.New("too many marathon runs in progress, try again later")
+)
+
+// newMarathonRun builds a run for a player over the countries of region,
+// or the whole catalog when region is empty, in random order.
+func newMarathonRun(playerID, region string) (*game.MarathonRun, error) {
+	c, err := getCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	countries := c.filter(region)
+	if len(countries) == 0 {
+		return nil, errUnknownRegion
+	}
+
+	rng := newRandomGenerator()
+	shuffleCountries(countries, rng)
+
+	questions := make([]game.Question, 0, len(countries))
+	for _, country := range countries {
+		questions = append(questions, game.Question{
+			FlagURL: country.FlagURL(),
+			Answer:  country.Name,
+			Options: pickOptions(c.countries, country, country.Name, func(c *game.Country) string {
+				return c.Name
+			}, rng),
+		})
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &game.MarathonRun{
+		ID:        hex.EncodeToString(id),
+		PlayerID:  playerID,
+		Region:    region,
+		Questions: questions,
+		Missed:    []game.MissedFlag{},
+		StartedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// loadMarathonRuns reads the checkpoints of every run into memory on first
+// use, so that runs survive a server restart. Callers must hold marathonMu.
+func loadMarathonRuns() {
+	if marathonLoaded {
+		return
+	}
+	marathonLoaded = true
+
+	runs, err := dataStore.MarathonRuns()
+	if err != nil {
+		log.Printf("Failed to load marathon checkpoints: %v", err)
+		return
+	}
+
+	for i := range runs {
+		if !marathonIDPattern.MatchString(runs[i].ID) {
+			log.Printf("Skipping invalid marathon checkpoint %q", runs[i].ID)
+			continue
+		}
+		marathonRuns[runs[i].ID] = &runs[i]
+	}
+}
+
+// getMarathonRun returns a run by id. Callers must hold marathonMu.
+func getMarathonRun(id string) (*game.MarathonRun, error) {
+	loadMarathonRuns()
+
+	run, ok := marathonRuns[id]
+	if !ok || !marathonIDPattern.MatchString(id) {
+		return nil, errMarathonNotFound
+	}
+	return run, nil
+}
+
+// deleteMarathonRun forgets a run and deletes its checkpoint. Callers must
+// hold marathonMu.
+func deleteMarathonRun(id string) {
+	delete(marathonRuns, id)
+	if err := dataStore.DeleteMarathonRun(id); err != nil {
+		log.Printf("Failed to delete marathon checkpoint %s: %v", id, err)
+	}
+}
+
+// cleanupMarathonRuns deletes runs idle for longer than marathonRunTTL.
+// Callers must hold marathonMu.
+func cleanupMarathonRuns(now time.Time) {
+	for id, run := range marathonRuns {
+		if now.Sub(run.UpdatedAt) > marathonRunTTL {
+			deleteMarathonRun(id)
+		}
+	}
+}
+
+// addMarathonRun keeps a new run, dropping the player's least recently
+// played runs beyond maxMarathonRunsPerPlayer. Callers must hold
+// marathonMu.
+func addMarathonRun(run *game.MarathonRun) error {
+	loadMarathonRuns()
+	cleanupMarathonRuns(run.StartedAt)
+
+	var owned []*game.MarathonRun
+	for _, other := range marathonRuns {
+		if other.PlayerID == run.PlayerID {
+			owned = append(owned, other)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		return owned[i].UpdatedAt.Before(owned[j].UpdatedAt)
+	})
+	for len(owned) >= maxMarathonRunsPerPlayer {
+		deleteMarathonRun(owned[0].ID)
+		owned = owned[1:]
+	}
+
+	if len(marathonRuns) >= maxMarathonRuns {
+		return errMarathonLimit
+	}
+
+	marathonRuns[run.ID] = run
+	checkpointMarathon(run)
+	return nil
+}
+
+// checkpointMarathon saves the run's progress to the store.
+func checkpointMarathon(run *game.MarathonRun) {
+	if err := dataStore.SaveMarathonRun(*run); err != nil {
+		log.Printf("Failed to checkpoint marathon %s: %v", run.ID, err)
+	}
+}
+
+// marathonView is the client's view of a run. It only includes the current
+// question, without its answer, and the summary once the run is complete.
+func marathonView(run *game.MarathonRun) map[string]interface{} {
+	view := map[string]interface{}{
+		"id":        run.ID,
+		"region":    run.Region,
+		"index":     run.Index,
+		"total":     len(run.Questions),
+		"correct":   run.Correct,
+		"missed":    len(run.Missed),
+		"completed": run.Completed(),
+	}
+
+	if run.Completed() {
+		view["summary"] = marathonSummary(run)
+	} else {
+		question := run.Questions[run.Index]
+		view["question"] = map[string]interface{}{
+			"question_index": run.Index,
+			"flag_url":       question.FlagURL,
+			"options":        question.Options,
+		}
+	}
+
+	return view
+}
+
+// marathonSummary lists the result of a completed run and every flag the
+// player missed.
+func marathonSummary(run *game.MarathonRun) map[string]interface{} {
+	accuracy := 0.0
+	if len(run.Questions) > 0 {
+		accuracy = float64(run.Correct) / float64(len(run.Questions))
+	}
+
+	summary := map[string]interface{}{
+		"total":        len(run.Questions),
+		"correct":      run.Correct,
+		"accuracy":     accuracy,
+		"missed_flags": run.Missed,
+		"started_at":   run.StartedAt,
+	}
+
+	if run.CompletedAt != nil {
+		summary["completed_at"] = run.CompletedAt
+		summary["duration_seconds"] = int(run.CompletedAt.Sub(run.StartedAt).Seconds())
+	}
+
+	return summary
+}
+
+// startMarathonHandler starts a new marathon run.
+//
+// HTTP Method: POST
+// Content-Type: application/json
+//
+// Request Body:
+//   - region: Optional continent to restrict the run to
+//
+// Response:
+//   - 200: The new run, including its id and first question. Starting a
+//     run drops the player's least recently played runs beyond the last 3.
+//   - 400: Invalid request or unknown region
+//   - 500: Server error while building the run
+//   - 503: Too many runs in progress
+func startMarathonHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Region string `json:"region"`
+	}
+
+	// An empty body starts a run over the whole catalog
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON format"})
+			return
+		}
+	}
+
+	run, err := newMarathonRun(requestPlayerID(r), req.Region)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == errUnknownRegion {
+			status = http.StatusBadRequest
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	marathonMu.Lock()
+	defer marathonMu.Unlock()
+
+	if err := addMarathonRun(run); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+	view := marathonView(run)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// getMarathonHandler returns a run's progress and current question, which
+// is how a paused run is resumed.
+//
+// HTTP Method: GET
+// Path Parameter:
+//   - id: Run identifier
+//
+// Response:
+//   - 200: Run progress
+//   - 404: Run not found
+func getMarathonHandler(w http.ResponseWriter, r *http.Request) {
+	marathonMu.Lock()
+	defer marathonMu.Unlock()
+
+	run, err := getMarathonRun(mux.Vars(r)["id"])
+	if err != nil {
+		writeMarathonError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(marathonView(run))
+}
+
+// marathonAnswerHandler records the answer to the run's current question
+// and checkpoints the run.
+//
+// HTTP Method: POST
+// Content-Type: application/json
+// Path Parameter:
+//   - id: Run identifier
+//
+// Request Body:
+//   - question_index: Index of the question being answered
+//   - answer: The chosen country name
+//
+// Response:
+//   - 200: Answer result and the updated run
+//   - 400: Invalid request
+//   - 404: Run not found
+//   - 409: The question is not the run's current question, or the run is complete
+func marathonAnswerHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		QuestionIndex int    `json:"question_index"`
+		Answer        string `json:"answer"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON format"})
+		return
+	}
+
+	marathonMu.Lock()
+	defer marathonMu.Unlock()
+
+	run, err := getMarathonRun(mux.Vars(r)["id"])
+	if err != nil {
+		writeMarathonError(w, err)
+		return
+	}
+
+	if run.Completed() || req.QuestionIndex != run.Index {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Question is not the current question of this run"})
+		return
+	}
+
+	question := run.Questions[run.Index]
+	isCorrect := question.Answer == req.Answer
+
+	if isCorrect {
+		run.Correct++
+	} else {
+		run.Missed = append(run.Missed, game.MissedFlag{
+			FlagURL:      question.FlagURL,
+			Country:      question.Answer,
+			ChosenAnswer: req.Answer,
+		})
+	}
+
+	run.Index++
+	run.UpdatedAt = time.Now()
+	if run.Completed() {
+		completedAt := run.UpdatedAt
+		run.CompletedAt = &completedAt
+	}
+
+	checkpointMarathon(run)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"correct":        isCorrect,
+		"correct_answer": question.Answer,
+		"chosen_answer":  req.Answer,
+		"run":            marathonView(run),
+	})
+}
+
+// marathonSummaryHandler returns the completion summary of a finished run.
+//
+// HTTP Method: GET
+// Path Parameter:
+//   - id: Run identifier
+//
+// Response:
+//   - 200: Summary including the missed flags
+//   - 404: Run not found
+//   - 409: Run is not complete yet
+func marathonSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	marathonMu.Lock()
+	defer marathonMu.Unlock()
+
+	run, err := getMarathonRun(mux.Vars(r)["id"])
+	if err != nil {
+		writeMarathonError(w, err)
+		return
+	}
+
+	if !run.Completed() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Marathon run is not complete yet"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(marathonSummary(run))
+}
+
+func writeMarathonError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if err == errMarathonNotFound {
+		status = http.StatusNotFound
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+}
@@ -0,0 +1,346 @@
+package internals
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+const (
+	// minMatchPlayers players of similar rating waiting for the same mode
+	// and region are matched straight away. Once a player has waited
+	// matchWaitTimeout, they are matched with any one or more others.
+	minMatchPlayers  = 4
+	matchWaitTimeout = 30 * time.Second
+
+	// matchRetryInterval is how often waiting players check whether their
+	// queue can be matched now.
+	matchRetryInterval = time.Second
+
+	// matchJoinTimeout is how long a matched room waits for its players
+	// to connect before the countdown starts anyway.
+	matchJoinTimeout = 20 * time.Second
+
+	// Players are matched straight away with others rated within
+	// matchRatingWindow of them. The window widens by matchWindowGrowth
+	// points for every second waited and is dropped once the wait is over.
+	matchRatingWindow = 150
+	matchWindowGrowth = 10
+
+	// maxRegionLength is the longest region name rooms and tickets accept.
+	maxRegionLength = 32
+)
+
+// Settings of rooms created by matchmaking
+const (
+	matchTimeLimit    = 5 // in minutes
+	matchNumQuestions = 15
+)
+
+// matchTicket is a player waiting in the matchmaking queue.
+type matchTicket struct {
+	player   *game.Player
+	rating   int
+	mode     string
+	region   string
+	queuedAt time.Time
+	matched  chan *game.Room
+}
+
+// matchKey groups the tickets that can be matched with each other.
+type matchKey struct {
+	mode   string
+	region string
+}
+
+var (
+	matchMu    sync.Mutex
+	matchQueue = make(map[matchKey][]*matchTicket)
+)
+
+// matchRequest builds the room settings used for a quick match.
+func matchRequest(mode, region string) game.CreateRoomRequest {
+	return game.CreateRoomRequest{
+		TimeLimit:    matchTimeLimit,
+		NumQuestions: matchNumQuestions,
+		GameType:     mode,
+		Region:       region,
+	}
+}
+
+// enqueueMatch adds a ticket to the queue and tries to match it. It returns
+// the number of players that were waiting, including this one.
+func enqueueMatch(ticket *matchTicket) int {
+	key := matchKey{ticket.mode, ticket.region}
+
+	matchMu.Lock()
+	matchQueue[key] = append(matchQueue[key], ticket)
+	waiting := len(matchQueue[key])
+	matchMu.Unlock()
+
+	tryMatch(key)
+	return waiting
+}
+
+// dequeueMatch removes a ticket that is still waiting from the queue.
+func dequeueMatch(ticket *matchTicket) {
+	key := matchKey{ticket.mode, ticket.region}
+
+	matchMu.Lock()
+	defer matchMu.Unlock()
+
+	queue := matchQueue[key]
+	for i, t := range queue {
+		if t == ticket {
+			matchQueue[key] = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(matchQueue[key]) == 0 {
+		delete(matchQueue, key)
+	}
+}
+
+// ratingGroup returns the tickets of queue closest in rating to anchor,
+// anchor first, up to a full room. Unless the anchor has waited long enough
+// only tickets within its rating window are considered.
+func ratingGroup(queue []*matchTicket, anchor *matchTicket, now time.Time) []*matchTicket {
+	waited := now.Sub(anchor.queuedAt)
+	window := matchRatingWindow + matchWindowGrowth*int(waited.Seconds())
+
+	var group []*matchTicket
+	for _, ticket := range queue {
+		if waited < matchWaitTimeout && abs(ticket.rating-anchor.rating) > window {
+			continue
+		}
+		group = append(group, ticket)
+	}
+
+	sort.SliceStable(group, func(i, j int) bool {
+		return abs(group[i].rating-anchor.rating) < abs(group[j].rating-anchor.rating)
+	})
+	return group[:min(len(group), maxPlayers)]
+}
+
+// takeMatch removes and returns the tickets to put in a room together, or
+// nil when the queue for key is not ready to be matched. Players are tried
+// in the order they queued, each with the players closest to their rating.
+// Callers must hold matchMu.
+func takeMatch(key matchKey, now time.Time) []*matchTicket {
+	queue := matchQueue[key]
+
+	for _, anchor := range queue {
+		group := ratingGroup(queue, anchor, now)
+		if len(group) < 2 {
+			continue
+		}
+		if len(group) < minMatchPlayers && now.Sub(anchor.queuedAt) < matchWaitTimeout {
+			continue
+		}
+
+		var rest []*matchTicket
+		for _, ticket := range queue {
+			if !slices.Contains(group, ticket) {
+				rest = append(rest, ticket)
+			}
+		}
+		if len(rest) == 0 {
+			delete(matchQueue, key)
+		} else {
+			matchQueue[key] = rest
+		}
+		return group
+	}
+	return nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// tryMatch creates a room for the players waiting for key if there are
+// enough of them or they have waited long enough. Players whose room could
+// not be created go back to the front of the queue. No rooms are created
+// while the server is shutting down.
+func tryMatch(key matchKey) {
+	if shuttingDown.Load() {
+		return
+	}
+
+	matchMu.Lock()
+	group := takeMatch(key, time.Now())
+	matchMu.Unlock()
+
+	if group == nil {
+		return
+	}
+
+	room, err := createRoom(matchRequest(key.mode, key.region), group[0].player.Username)
+	if err != nil {
+		log.Printf("Failed to create matchmaking room: %v", err)
+
+		matchMu.Lock()
+		matchQueue[key] = append(group, matchQueue[key]...)
+		matchMu.Unlock()
+
+		for _, ticket := range group {
+			ticket.player.Send(map[string]string{"error": "No room is available yet, still waiting"})
+		}
+		return
+	}
+
+	for _, ticket := range group {
+		ticket.matched <- room
+	}
+
+	go autoStartRoom(room, len(group))
+}
+
+// autoStartRoom starts a matched room once all of its players have
+// connected, or after matchJoinTimeout if some of them never do.
+func autoStartRoom(room *game.Room, expected int) {
+	deadline := time.Now().Add(matchJoinTimeout)
+	for playerCount(room) < expected && time.Now().Before(deadline) {
+		time.Sleep(250 * time.Millisecond)
+	}
+
+	// Nobody showed up, the room is cleaned up like any other empty room.
+	// Rooms still waiting when the server shuts down are closed instead.
+	if playerCount(room) == 0 || shuttingDown.Load() {
+		return
+	}
+
+	startGame(room)
+}
+
+// matchmakingHandler puts a player in the quick match queue over a
+// WebSocket. Players waiting for the same mode and region are grouped into
+// a new room as soon as minMatchPlayers of them of similar rating are
+// waiting, or once one of them has waited matchWaitTimeout.
+//
+// The initial message contains:
+//   - username: The display name of the player (4-20 characters), by
+//     default the one remembered for their guest identity
+//   - mode: The game type to play
+//   - region: Optional region players are matched within, such as "europe"
+//   - token: Optional guest identity token for clients without the
+//     identity cookie, used to match players of similar rating
+//
+// The server replies with a "queued" event carrying the number of players
+// waiting, and then a "match_found" event with the code of the new room.
+// The player joins the room on /ws as usual and the countdown starts once
+// everyone matched has connected. Sending "leave" leaves the queue.
+func matchmakingHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, upgradeHeader(w))
+	if err != nil {
+		log.Println("WebSocket Upgrade error:", err)
+		http.Error(w, "Could not open WebSocket connection", http.StatusInternalServerError)
+		return
+	}
+
+	defer conn.Close()
+
+	var initialMessage struct {
+		Username string `json:"username"`
+		Mode     string `json:"mode"`
+		Region   string `json:"region"`
+		Token    string `json:"token"`
+	}
+	if err := conn.ReadJSON(&initialMessage); err != nil {
+		log.Println("Failed to read initial message:", err)
+		conn.WriteJSON(map[string]string{"error": "Invalid initial message"})
+		return
+	}
+
+	if shuttingDown.Load() {
+		conn.WriteJSON(map[string]string{"error": "Server is shutting down. Please try again later."})
+		return
+	}
+
+	identity := socketIdentity(r, initialMessage.Token)
+	if initialMessage.Username == "" {
+		initialMessage.Username = identity.Username
+	}
+
+	if len(initialMessage.Username) < 4 || len(initialMessage.Username) > 20 {
+		conn.WriteJSON(map[string]string{"error": "Username must be between 4 and 20 characters"})
+		return
+	}
+
+	mode := strings.ToUpper(initialMessage.Mode)
+	req := matchRequest(mode, initialMessage.Region)
+	if err := ValidateCreateRoomRequest(&req); err != nil {
+		conn.WriteJSON(map[string]string{"error": err.Error()})
+		return
+	}
+	region := req.Region
+
+	ticket := &matchTicket{
+		player: &game.Player{
+			ID:       generatePlayerID(),
+			Username: initialMessage.Username,
+			Conn:     conn,
+		},
+		rating:   playerRating(identity.ID),
+		mode:     mode,
+		region:   region,
+		queuedAt: time.Now(),
+		matched:  make(chan *game.Room, 1),
+	}
+	key := matchKey{mode, region}
+
+	waiting := enqueueMatch(ticket)
+	defer dequeueMatch(ticket)
+
+	ticket.player.Send(map[string]interface{}{
+		"event": "queued",
+		"data": map[string]interface{}{
+			"mode":            mode,
+			"region":          region,
+			"rating":          ticket.rating,
+			"players_waiting": waiting,
+			"min_players":     minMatchPlayers,
+			"wait_seconds":    int(matchWaitTimeout.Seconds()),
+		},
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	messages := readMessages(conn, ticket.player, done)
+
+	retry := time.NewTicker(matchRetryInterval)
+	defer retry.Stop()
+
+	for {
+		select {
+		case room := <-ticket.matched:
+			ticket.player.Send(map[string]interface{}{
+				"event": "match_found",
+				"data": map[string]interface{}{
+					"room_id":  room.Code,
+					"gamemode": room.GameMode,
+					"host":     room.Hostname,
+				},
+			})
+			return
+
+		case <-retry.C:
+			// Smaller groups are matched once the wait is over
+			tryMatch(key)
+
+		case message, ok := <-messages:
+			if !ok || message.Event == "leave" {
+				return
+			}
+		}
+	}
+}
@@ -54,21 +54,97 @@ func generatePlayerID() string {
 //
 // Validates:
 //   - Time limit (3-10 minutes)
-//   - Number of questions (10-25)
-//   - Game type (must not be empty)
+//   - Number of questions (10-25), ignored by modes without a question count
+//   - Game type (must not be empty and must be a supported game type)
+//   - Question time limit (0 to disable, otherwise 5-30 seconds)
+//   - Teams (0 to disable, otherwise 2-4)
+//   - Password (optional, at most 64 characters)
+//   - Region (optional, at most 32 characters)
 func ValidateCreateRoomRequest(req *game.CreateRoomRequest) error {
 	if req.TimeLimit < 3 || req.TimeLimit > 10 {
 		return errors.New("time limit must be between 3 and 10 minutes")
 	}
-	if req.NumQuestions < 10 || req.NumQuestions > 25 {
+	if game.HasQuestionCount(req.GameType) && (req.NumQuestions < 10 || req.NumQuestions > 25) {
 		return errors.New("number of questions must be between 10 and 25")
 	}
 	if req.GameType == "" {
 		return errors.New("game type is required")
 	}
+	if !game.IsValidGameType(req.GameType) {
+		return fmt.Errorf("unknown game type %q", req.GameType)
+	}
+	if req.QuestionTimeLimit != 0 && (req.QuestionTimeLimit < minQuestionTimeLimit || req.QuestionTimeLimit > maxQuestionTimeLimit) {
+		return fmt.Errorf("question time limit must be between %d and %d seconds", minQuestionTimeLimit, maxQuestionTimeLimit)
+	}
+	if req.Teams != 0 && (req.Teams < minTeams || req.Teams > maxTeams) {
+		return fmt.Errorf("teams must be between %d and %d", minTeams, maxTeams)
+	}
+	if len(req.Password) > maxRoomPasswordLength {
+		return fmt.Errorf("password must be at most %d characters", maxRoomPasswordLength)
+	}
+	req.Region = strings.ToLower(strings.TrimSpace(req.Region))
+	if len(req.Region) > maxRegionLength {
+		return fmt.Errorf("region must be at most %d characters", maxRegionLength)
+	}
 	return nil
 }
 
+// errRoomLimit is returned when the server already hosts as many rooms as
+// it allows.
+var errRoomLimit = errors.New("Maximum number of rooms (10) reached. Cannot create more rooms.")
+
+// createRoom generates the questions for a validated request and registers
+// a new room hosted by host. It is shared by createRoomHandler and
+// matchmaking.
+func createRoom(req game.CreateRoomRequest, host string) (*game.Room, error) {
+	questions, err := generateQuestions(req.NumQuestions, req.GameType)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate questions: %w", err)
+	}
+
+	room := &game.Room{
+		Hostname:  host,
+		Players:   make(map[*websocket.Conn]*game.Player),
+		Questions: make(map[string]*game.Question),
+		Start:     false,
+		TimeLimit: req.TimeLimit,
+		GameMode:  req.GameType,
+
+		Region:     req.Region,
+		Public:     req.Public,
+		Spectators: make(map[*websocket.Conn]*game.Player),
+
+		QuestionTimeLimit: req.QuestionTimeLimit,
+		Teams:             req.Teams,
+	}
+
+	for i, q := range questions {
+		room.Questions[strconv.Itoa(i)] = &q
+	}
+
+	if err := setRoomPassword(room, req.Password); err != nil {
+		return nil, fmt.Errorf("Failed to set room password: %w", err)
+	}
+
+	// The limit is checked where the room is registered, so that rooms
+	// created at the same time cannot both take the last place
+	mu.Lock()
+	if len(rooms) >= 10 {
+		mu.Unlock()
+		return nil, errRoomLimit
+	}
+	room.Code = generateRoomID()
+	for rooms[room.Code] != nil {
+		room.Code = generateRoomID()
+	}
+	rooms[room.Code] = room
+	mu.Unlock()
+	notifyLobby()
+	saveRoom(room)
+
+	return room, nil
+}
+
 // createRoomHandler processes HTTP POST requests to create a new game room.
 // It validates the request, generates a unique room ID, and initializes
 // the room with the specified parameters and questions.
@@ -77,19 +153,28 @@ func ValidateCreateRoomRequest(req *game.CreateRoomRequest) error {
 // Content-Type: application/json
 //
 // Request Body:
-//   - CreateRoomRequest struct with additional HostUsername field
+//   - CreateRoomRequest struct with additional HostUsername field, which
+//     defaults to the name remembered for the caller's guest identity
 //
 // Response:
 //   - 200: Room created successfully with room details
 //   - 400: Invalid request parameters
 //   - 403: Maximum room limit reached
 //   - 500: Server error during question generation
+//   - 503: Server is shutting down
 func createRoomHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if shuttingDown.Load() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Server is shutting down. Please try again later."})
+		return
+	}
+
 	var req struct {
 		game.CreateRoomRequest
 		HostUsername string `json:"hostUsername"`
@@ -113,13 +198,8 @@ func createRoomHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(rooms) >= 10 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(ErrorResponse{
-			Error: "Maximum number of rooms (10) reached. Cannot create more rooms.",
-		})
-		return
+	if req.HostUsername == "" {
+		req.HostUsername = requestIdentity(r).Username
 	}
 
 	if req.HostUsername == "" {
@@ -131,32 +211,21 @@ func createRoomHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	questions, err := generateQuestions(req.NumQuestions, req.GameType)
+	room, err := createRoom(req.CreateRoomRequest, req.HostUsername)
 	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errRoomLimit) {
+			status = http.StatusForbidden
+		}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(ErrorResponse{
-			Error: "Failed to generate questions: " + err.Error(),
+			Error: err.Error(),
 		})
 		return
 	}
 
-	roomID := generateRoomID()
-	room := &game.Room{
-		Code:      roomID,
-		Hostname:  req.HostUsername,
-		Players:   make(map[*websocket.Conn]*game.Player),
-		Questions: make(map[string]*game.Question),
-		Start:     false,
-		TimeLimit: req.TimeLimit,
-		GameMode:  req.GameType,
-	}
-
-	for i, q := range questions {
-		room.Questions[strconv.Itoa(i)] = &q
-	}
-
-	rooms[roomID] = room
+	rememberUsername(w, r, req.HostUsername)
 
 	response := map[string]interface{}{
 		"code":         room.Code,
@@ -164,8 +233,13 @@ func createRoomHandler(w http.ResponseWriter, r *http.Request) {
 		"players":      getSerializablePlayers(room),
 		"start":        room.Start,
 		"timeLimit":    room.TimeLimit,
-		"numQuestions": len(questions),
+		"numQuestions": len(room.Questions),
 		"gamemode":     room.GameMode,
+		"public":       room.Public,
+		"hasPassword":  len(room.PasswordHash) > 0,
+
+		"questionTimeLimit": room.QuestionTimeLimit,
+		"teams":             room.Teams,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -180,25 +254,40 @@ func createRoomHandler(w http.ResponseWriter, r *http.Request) {
 // Content-Type: application/json
 //
 // Request Body:
-//   - Username: Player's desired username (4-20 characters)
+//   - Username: Player's desired username (4-20 characters), by default
+//     the one remembered for the caller's guest identity
 //   - RoomID: Target room identifier
+//   - Team: Optional team to join in rooms with teams
+//   - Password: Required for rooms created with a password
 //
 // Response:
-//   - 200: Successfully joined room with room details
+//   - 200: Successfully joined room with room details, and for rooms with
+//     a password a joinToken to send in the initial /ws message instead
 //   - 400: Invalid request parameters
 //   - 404: Room not found
 //   - 409: Username conflict
-//   - 403: Room is full
+//   - 403: Room is full or the password is wrong
 //   - 401: Game has started in this room
+//   - 429: Too many wrong passwords from this address
+//   - 503: Server is shutting down
 func joinRoomHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if shuttingDown.Load() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Server is shutting down. Please try again later."})
+		return
+	}
+
 	var req struct {
 		Username string `json:"username"`
 		RoomID   string `json:"roomID"`
+		Team     int    `json:"team"`
+		Password string `json:"password"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -208,6 +297,10 @@ func joinRoomHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Username == "" {
+		req.Username = requestIdentity(r).Username
+	}
+
 	// Validate username
 	if req.Username == "" || len(req.Username) < 4 || len(req.Username) > 20 {
 		w.Header().Set("Content-Type", "application/json")
@@ -224,7 +317,7 @@ func joinRoomHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, exists := rooms[req.RoomID]
+	room, exists := lookupRoom(req.RoomID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -233,6 +326,17 @@ func joinRoomHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := checkRoomPassword(room, req.Password, clientAddress(r)); err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, errTooManyPasswordTries) {
+			status = http.StatusTooManyRequests
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	if room.Start {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
@@ -240,7 +344,7 @@ func joinRoomHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(room.Players) >= 9 {
+	if playerCount(room) >= maxPlayers {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(ErrorResponse{Error: "Room is full, only 9 members can join in one room"})
@@ -248,7 +352,7 @@ func joinRoomHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	usernameExists := false
-	for _, player := range room.Players {
+	for _, player := range roomPlayers(room) {
 		if player != nil && strings.EqualFold(player.Username, req.Username) {
 			usernameExists = true
 			break
@@ -264,12 +368,27 @@ func joinRoomHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if room.Teams > 0 {
+		if _, err := assignTeam(room, nil, req.Team); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	rememberUsername(w, r, req.Username)
+
 	response := map[string]interface{}{
 		"code":         room.Code,
 		"host":         room.Hostname,
 		"players":      getSerializablePlayers(room),
 		"timeLimit":    room.TimeLimit,
 		"numQuestions": len(room.Questions),
+		"teams":        room.Teams,
+	}
+	if token := issueJoinToken(room); token != "" {
+		response["joinToken"] = token
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -290,7 +409,7 @@ func getRoomHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	roomID := vars["id"]
 
-	room, exists := rooms[roomID]
+	room, exists := lookupRoom(roomID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -306,6 +425,12 @@ func getRoomHandler(w http.ResponseWriter, r *http.Request) {
 		"timeLimit":    room.TimeLimit,
 		"numQuestions": len(room.Questions),
 		"gamemode":     room.GameMode,
+		"public":       room.Public,
+		"hasPassword":  len(room.PasswordHash) > 0,
+		"spectators":   spectatorCount(room),
+
+		"questionTimeLimit": room.QuestionTimeLimit,
+		"teams":             room.Teams,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -321,7 +446,8 @@ func adminHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(rooms) == 0 {
+	list := snapshotRooms()
+	if len(list) == 0 {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(ErrorResponse{Error: "No room found"})
@@ -330,7 +456,7 @@ func adminHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Create a response structure to hold all room details
 	var allRooms []map[string]interface{}
-	for _, room := range rooms {
+	for _, room := range list {
 		roomDetails := map[string]interface{}{
 			"code":         room.Code,
 			"host":         room.Hostname,
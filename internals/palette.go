@@ -0,0 +1,240 @@
+package internals
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// minPaletteShare is the share of a flag a colour must cover to be part of
+// its palette, leaving out anti-aliasing seams and tiny details.
+const minPaletteShare = 0.005
+
+// minColorSetShare is the share a colour must cover to count as being on
+// the flag for questions and searches. Emblem details are not expected to
+// be recognised.
+const minColorSetShare = 0.02
+
+// paletteMergeDistance merges shades closer than this into one colour.
+const paletteMergeDistance = 40
+
+// colorNames lists the basic colour names in the order colour sets are
+// written in.
+var colorNames = []string{"red", "orange", "yellow", "green", "blue", "purple", "brown", "grey", "white", "black"}
+
+// attachPalettes extracts the palette of every flag in the catalog.
+func attachPalettes(c *catalog) error {
+	rasters, err := getFlagRasters()
+	if err != nil {
+		return err
+	}
+
+	for i := range c.countries {
+		if raster, ok := rasters[c.countries[i].ISO2]; ok {
+			c.countries[i].Colors = flagPalette(raster)
+		}
+	}
+	return nil
+}
+
+// flagPalette returns the colours of a flag weighted by the area they
+// cover, most dominant first. Similar shades are merged into the most
+// common one.
+func flagPalette(raster *flagRaster) []game.FlagColor {
+	cells := make(map[string]int)
+	total := 0
+	for _, row := range raster {
+		for _, color := range row {
+			if color != "" {
+				cells[color]++
+				total++
+			}
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	colors := sortedKeys(cells)
+	sort.SliceStable(colors, func(i, j int) bool {
+		return cells[colors[i]] > cells[colors[j]]
+	})
+
+	var palette []game.FlagColor
+	for _, color := range colors {
+		share := float64(cells[color]) / float64(total)
+
+		merged := false
+		for i := range palette {
+			if colorDistance(palette[i].Hex, color) < paletteMergeDistance {
+				palette[i].Share += share
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			palette = append(palette, game.FlagColor{Hex: color, Name: colorName(color), Share: share})
+		}
+	}
+
+	kept := palette[:0]
+	for _, color := range palette {
+		if color.Share >= minPaletteShare {
+			color.Share = math.Round(color.Share*1000) / 1000
+			kept = append(kept, color)
+		}
+	}
+	return kept
+}
+
+// colorName classifies a colour by hue and lightness into one of the
+// basic colour names.
+func colorName(hex string) string {
+	r, g, b := rgbComponents(hex)
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	high, low := math.Max(rf, math.Max(gf, bf)), math.Min(rf, math.Min(gf, bf))
+	lightness := (high + low) / 2
+
+	saturation := 0.0
+	if high != low {
+		saturation = (high - low) / (1 - math.Abs(2*lightness-1))
+	}
+
+	switch {
+	case lightness > 0.9:
+		return "white"
+	case lightness < 0.12:
+		return "black"
+	case saturation < 0.2:
+		if lightness > 0.75 {
+			return "white"
+		}
+		return "grey"
+	}
+
+	var hue float64
+	switch high {
+	case rf:
+		hue = math.Mod((gf-bf)/(high-low), 6)
+	case gf:
+		hue = (bf-rf)/(high-low) + 2
+	default:
+		hue = (rf-gf)/(high-low) + 4
+	}
+	hue *= 60
+	if hue < 0 {
+		hue += 360
+	}
+
+	switch {
+	case hue < 15 || hue >= 330:
+		return "red"
+	case hue < 45:
+		if lightness < 0.3 {
+			return "brown"
+		}
+		return "orange"
+	case hue < 70:
+		return "yellow"
+	case hue < 170:
+		return "green"
+	case hue < 260:
+		return "blue"
+	default:
+		return "purple"
+	}
+}
+
+// colorSet returns the distinct colour names of a palette in the order of
+// colorNames, leaving out colours that only appear in small details.
+func colorSet(palette []game.FlagColor) []string {
+	shares := make(map[string]float64)
+	for _, color := range palette {
+		shares[color.Name] += color.Share
+	}
+	present := make(map[string]bool)
+	for name, share := range shares {
+		present[name] = share >= minColorSetShare
+	}
+
+	var names []string
+	for _, name := range colorNames {
+		if present[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func colorSetLabel(names []string) string {
+	return strings.Join(names, ", ")
+}
+
+// hasColors reports whether a country's flag contains every named colour.
+func hasColors(country *game.Country, names []string) bool {
+	set := colorSet(country.Colors)
+	for _, name := range names {
+		if !containsString(set, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// generateColorQuestions builds questions that show a country name and ask
+// which set of colours appears on its flag. Distractors are the colour
+// sets of other flags, preferring flags from the same continent.
+func generateColorQuestions(c *catalog, numQuestions int, rng *rand.Rand) []game.Question {
+	var candidates []game.Country
+	for _, country := range c.countries {
+		if len(country.Colors) > 0 {
+			candidates = append(candidates, country)
+		}
+	}
+
+	selected := selectRandomCountries(append([]game.Country(nil), candidates...), numQuestions, rng)
+
+	questions := make([]game.Question, 0, len(selected))
+	for _, country := range selected {
+		answer := colorSetLabel(colorSet(country.Colors))
+
+		var sameContinent, others []string
+		seen := map[string]bool{answer: true}
+		for i := range candidates {
+			label := colorSetLabel(colorSet(candidates[i].Colors))
+			if seen[label] {
+				continue
+			}
+			seen[label] = true
+			if candidates[i].Continent == country.Continent {
+				sameContinent = append(sameContinent, label)
+			} else {
+				others = append(others, label)
+			}
+		}
+		shuffleOptions(sameContinent, rng)
+		shuffleOptions(others, rng)
+
+		options := []string{answer}
+		for _, pool := range [][]string{sameContinent, others} {
+			for _, label := range pool {
+				if len(options) == 4 {
+					break
+				}
+				options = append(options, label)
+			}
+		}
+		shuffleOptions(options, rng)
+
+		questions = append(questions, game.Question{
+			Prompt:  country.Name,
+			Options: options,
+			Answer:  answer,
+			Country: country.ISO2,
+		})
+	}
+	return questions
+}
@@ -0,0 +1,173 @@
+package internals
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	maxRoomPasswordLength = 64
+	passwordIterations    = 100_000
+	passwordSaltLength    = 16
+
+	// maxPasswordAttempts wrong room passwords are allowed from an address
+	// within passwordAttemptWindow before it is locked out.
+	maxPasswordAttempts   = 5
+	passwordAttemptWindow = 10 * time.Minute
+
+	// joinTokenTTL is how long the token handed out by /api/joinroom lets
+	// a player connect to the room without sending the password again.
+	joinTokenTTL = 2 * time.Minute
+)
+
+// Reasons a room password is refused.
+var (
+	errWrongPassword        = errors.New("incorrect room password")
+	errTooManyPasswordTries = errors.New("too many incorrect passwords, please try again later")
+)
+
+type passwordAttempts struct {
+	failures int
+	since    time.Time
+}
+
+var (
+	attemptsMu       sync.Mutex
+	passwordFailures = make(map[string]*passwordAttempts)
+)
+
+// hashRoomPassword derives a 32-byte key from password and salt with
+// PBKDF2-HMAC-SHA256.
+func hashRoomPassword(password string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(password), salt, passwordIterations, sha256.Size, sha256.New)
+}
+
+// setRoomPassword stores a salted hash of password on the room. An empty
+// password leaves the room open.
+func setRoomPassword(room *game.Room, password string) error {
+	if password == "" {
+		return nil
+	}
+
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	room.PasswordSalt = salt
+	room.PasswordHash = hashRoomPassword(password, salt)
+	return nil
+}
+
+// clientAddress returns the IP address a request came from.
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// checkRoomPassword verifies password for a protected room. Addresses that
+// get the password wrong too often are locked out for a while, whichever
+// room they try.
+func checkRoomPassword(room *game.Room, password, addr string) error {
+	if len(room.PasswordHash) == 0 {
+		return nil
+	}
+
+	attemptsMu.Lock()
+	now := time.Now()
+	for a, attempts := range passwordFailures {
+		if now.Sub(attempts.since) > passwordAttemptWindow {
+			delete(passwordFailures, a)
+		}
+	}
+	attempts := passwordFailures[addr]
+	if attempts != nil && attempts.failures >= maxPasswordAttempts {
+		attemptsMu.Unlock()
+		return errTooManyPasswordTries
+	}
+
+	// The attempt is counted as a failure before hashing, so concurrent
+	// guesses cannot all pass the check above while the hash is computed
+	if attempts == nil {
+		attempts = &passwordAttempts{since: now}
+		passwordFailures[addr] = attempts
+	}
+	attempts.failures++
+	attemptsMu.Unlock()
+
+	// Hashing is deliberately slow, so it is done without holding the lock
+	hash := hashRoomPassword(password, room.PasswordSalt)
+	if subtle.ConstantTimeCompare(hash, room.PasswordHash) != 1 {
+		return errWrongPassword
+	}
+
+	// A correct password gives the reserved attempt back
+	attemptsMu.Lock()
+	defer attemptsMu.Unlock()
+
+	attempts.failures--
+	if attempts.failures <= 0 && passwordFailures[addr] == attempts {
+		delete(passwordFailures, addr)
+	}
+	return nil
+}
+
+// signJoinToken returns the signature of a join token for a room that
+// expires at expiry, given as Unix seconds.
+func signJoinToken(code string, expiry int64) []byte {
+	mac := hmac.New(sha256.New, serverSecret)
+	mac.Write([]byte("join:" + code + ":"))
+	binary.Write(mac, binary.BigEndian, expiry)
+	return mac.Sum(nil)
+}
+
+// issueJoinToken returns a token proving that the room's password was
+// checked, so that the WebSocket handshake that follows a join does not
+// hash it again. Rooms without a password need no token.
+func issueJoinToken(room *game.Room) string {
+	if len(room.PasswordHash) == 0 {
+		return ""
+	}
+
+	expiry := time.Now().Add(joinTokenTTL).Unix()
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, uint64(expiry))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signJoinToken(room.Code, expiry))
+}
+
+// validJoinToken reports whether token was issued for the room and has not
+// expired.
+func validJoinToken(room *game.Room, token string) bool {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(payload) != 8 {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	expiry := int64(binary.BigEndian.Uint64(payload))
+	return hmac.Equal(mac, signJoinToken(room.Code, expiry)) && time.Now().Unix() <= expiry
+}
@@ -0,0 +1,85 @@
+package internals
+
+import (
+	"log"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+	"github.com/adimail/fun-with-flags/internals/store"
+)
+
+// dataStore keeps room snapshots, game results and player profiles. It is
+// in memory until SetStore is called with a persistent store.
+var dataStore store.Store = store.NewMemory()
+
+// SetStore sets the store rooms, results and profiles are persisted to.
+func SetStore(s store.Store) {
+	dataStore = s
+}
+
+// saveRoom snapshots an open room so that it can be accounted for if the
+// server stops before the game ends. Finished games are already recorded.
+func saveRoom(room *game.Room) {
+	if room.Finished {
+		return
+	}
+
+	snapshot := game.RoomSnapshot{
+		Code:              room.Code,
+		Host:              room.Hostname,
+		GameMode:          room.GameMode,
+		Region:            room.Region,
+		NumQuestions:      len(room.Questions),
+		TimeLimit:         room.TimeLimit,
+		QuestionTimeLimit: room.QuestionTimeLimit,
+		Teams:             room.Teams,
+		Public:            room.Public,
+		Started:           room.Start,
+		Players:           buildResult(room, "").Standings,
+		UpdatedAt:         time.Now(),
+	}
+	if err := dataStore.SaveRoom(snapshot); err != nil {
+		log.Printf("Failed to save snapshot of room %s: %v", room.Code, err)
+	}
+}
+
+// forgetRoom drops the snapshot of a room that has closed.
+func forgetRoom(code string) {
+	if err := dataStore.DeleteRoom(code); err != nil {
+		log.Printf("Failed to delete snapshot of room %s: %v", code, err)
+	}
+}
+
+// RecoverRooms accounts for the rooms left open when the server last
+// stopped. Games that had started are recorded with the standings of their
+// last snapshot and the reason "interrupted"; rooms still in the lobby are
+// dropped. It returns the number of games recorded.
+func RecoverRooms() (int, error) {
+	snapshots, err := dataStore.Rooms()
+	if err != nil {
+		return 0, err
+	}
+
+	recovered := 0
+	for _, snapshot := range snapshots {
+		if snapshot.Started {
+			result := game.Result{
+				RoomCode:     snapshot.Code,
+				GameMode:     snapshot.GameMode,
+				Region:       snapshot.Region,
+				NumQuestions: snapshot.NumQuestions,
+				Standings:    snapshot.Players,
+				Reason:       "interrupted",
+				EndedAt:      snapshot.UpdatedAt,
+			}
+			if err := dataStore.AddResult(result); err != nil {
+				return recovered, err
+			}
+			recovered++
+		}
+		if err := dataStore.DeleteRoom(snapshot.Code); err != nil {
+			return recovered, err
+		}
+	}
+	return recovered, nil
+}
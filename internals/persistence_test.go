@@ -0,0 +1,87 @@
+package internals
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+	"github.com/adimail/fun-with-flags/internals/store"
+)
+
+func TestRecoverRooms(t *testing.T) {
+	defer SetStore(dataStore)
+
+	updated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	started := game.RoomSnapshot{
+		Code:         "1234",
+		GameMode:     game.GameTypeMCQ,
+		Region:       "europe",
+		NumQuestions: 10,
+		Started:      true,
+		Players: []game.Standing{
+			{Rank: 1, PlayerID: "p1", Username: "ana", Score: 6, ProfileID: "g1"},
+			{Rank: 2, PlayerID: "p2", Username: "ben", Score: 2, ProfileID: "g2"},
+		},
+		UpdatedAt: updated,
+	}
+	lobby := game.RoomSnapshot{
+		Code:         "5678",
+		GameMode:     game.GameTypeMCQ,
+		NumQuestions: 10,
+		Players:      []game.Standing{{PlayerID: "p3", Username: "cy"}},
+		UpdatedAt:    updated,
+	}
+
+	for name, s := range map[string]store.Store{
+		"file":   store.NewFile(t.TempDir()),
+		"memory": store.NewMemory(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			SetStore(s)
+			for _, snapshot := range []game.RoomSnapshot{started, lobby} {
+				if err := s.SaveRoom(snapshot); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			recovered, err := RecoverRooms()
+			if err != nil {
+				t.Fatalf("RecoverRooms(): %v", err)
+			}
+			if recovered != 1 {
+				t.Errorf("RecoverRooms() = %d, want 1", recovered)
+			}
+
+			// Only the started game is recorded, with its last standings
+			var results []game.Result
+			if err := s.EachResult(func(result game.Result) error {
+				results = append(results, result)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			want := []game.Result{{
+				RoomCode:     started.Code,
+				GameMode:     started.GameMode,
+				Region:       started.Region,
+				NumQuestions: started.NumQuestions,
+				Standings:    started.Players,
+				Reason:       "interrupted",
+				EndedAt:      updated,
+			}}
+			if !reflect.DeepEqual(results, want) {
+				t.Errorf("recorded results = %+v, want %+v", results, want)
+			}
+
+			// Every snapshot is gone, so a second start recovers nothing
+			rooms, err := s.Rooms()
+			if err != nil || len(rooms) != 0 {
+				t.Errorf("rooms after recovery = %v, %v, want none", rooms, err)
+			}
+			if recovered, err := RecoverRooms(); recovered != 0 || err != nil {
+				t.Errorf("second RecoverRooms() = %d, %v, want 0", recovered, err)
+			}
+		})
+	}
+}
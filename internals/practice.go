@@ -0,0 +1,327 @@
+package internals
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+var playerIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,64}$`)
+
+var (
+	practiceMu    sync.Mutex
+	practiceCards = make(map[string]map[string]*game.PracticeCard)
+)
+
+var errInvalidPlayerID = errors.New("Request has no valid guest identity")
+
+// practiceHistory returns the cards of a player, keyed by ISO2, loading
+// them from the store on first use. Callers must hold practiceMu.
+func practiceHistory(playerID string) (map[string]*game.PracticeCard, error) {
+	if cards, ok := practiceCards[playerID]; ok {
+		return cards, nil
+	}
+
+	cards, err := dataStore.PracticeCards(playerID)
+	if err != nil {
+		return nil, err
+	}
+	if cards == nil {
+		cards = make(map[string]*game.PracticeCard)
+	}
+
+	practiceCards[playerID] = cards
+	return cards, nil
+}
+
+func savePracticeHistory(playerID string, cards map[string]*game.PracticeCard) {
+	if err := dataStore.SavePracticeCards(playerID, cards); err != nil {
+		log.Printf("Failed to save practice history for %s: %v", playerID, err)
+	}
+}
+
+// selectPracticeCountries picks up to n countries for a practice session:
+// cards due for review first, weakest first, then countries the player has
+// not seen yet, then the remaining cards by how poorly they are known.
+func selectPracticeCountries(c *catalog, cards map[string]*game.PracticeCard, n int, now time.Time, rng *rand.Rand) []game.Country {
+	var due, unseen, rest []game.Country
+	for _, country := range c.countries {
+		card, ok := cards[country.ISO2]
+		switch {
+		case !ok || card.Attempts == 0:
+			unseen = append(unseen, country)
+		case card.IsDue(now):
+			due = append(due, country)
+		default:
+			rest = append(rest, country)
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		a, b := cards[due[i].ISO2], cards[due[j].ISO2]
+		if a.Ease != b.Ease {
+			return a.Ease < b.Ease
+		}
+		return a.Due.Before(b.Due)
+	})
+
+	shuffleCountries(unseen, rng)
+
+	sort.SliceStable(rest, func(i, j int) bool {
+		a, b := cards[rest[i].ISO2], cards[rest[j].ISO2]
+		if a.Accuracy() != b.Accuracy() {
+			return a.Accuracy() < b.Accuracy()
+		}
+		return a.Due.Before(b.Due)
+	})
+
+	selected := make([]game.Country, 0, n)
+	for _, pool := range [][]game.Country{due, unseen, rest} {
+		for _, country := range pool {
+			if len(selected) == n {
+				return selected
+			}
+			selected = append(selected, country)
+		}
+	}
+	return selected
+}
+
+// generatePracticeQuestions builds a practice session of n MCQ questions
+// for the player. Each question carries the country's ISO2 code so the
+// client can report the answer to /api/practice/review.
+func generatePracticeQuestions(playerID string, n int) ([]game.Question, error) {
+	c, err := getCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	practiceMu.Lock()
+	cards, err := practiceHistory(playerID)
+	if err != nil {
+		practiceMu.Unlock()
+		return nil, err
+	}
+	rng := newRandomGenerator()
+	selected := selectPracticeCountries(c, cards, n, time.Now(), rng)
+	practiceMu.Unlock()
+
+	questions := make([]game.Question, 0, len(selected))
+	for _, country := range selected {
+		questions = append(questions, game.Question{
+			FlagURL: country.FlagURL(),
+			Answer:  country.Name,
+			Country: country.ISO2,
+			Options: pickOptions(c.countries, country, country.Name, func(c *game.Country) string {
+				return c.Name
+			}, rng),
+		})
+	}
+	return questions, nil
+}
+
+// practiceReviewHandler records the answer to a practice question and
+// schedules the country's next review.
+//
+// HTTP Method: POST
+// Content-Type: application/json
+// Headers:
+//   - X-Identity-Token: Guest identity token, for clients without the
+//     guest identity cookie
+//
+// Request Body:
+//   - country: ISO2, ISO3 or numeric code of the country
+//   - correct: Whether the answer was correct
+//   - grade: Optional SM-2 grade (0-5), overrides correct
+//
+// Response:
+//   - 200: The updated card and its mastery level
+//   - 400: Invalid request or player ID
+//   - 404: Unknown country
+func practiceReviewHandler(w http.ResponseWriter, r *http.Request) {
+	playerID := requestPlayerID(r)
+	if !playerIDPattern.MatchString(playerID) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: errInvalidPlayerID.Error()})
+		return
+	}
+
+	var req struct {
+		Country string `json:"country"`
+		Correct bool   `json:"correct"`
+		Grade   *int   `json:"grade"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON format"})
+		return
+	}
+
+	if req.Grade != nil && (*req.Grade < 0 || *req.Grade > 5) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Grade must be between 0 and 5"})
+		return
+	}
+
+	c, err := getCatalog()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to load countries: " + err.Error()})
+		return
+	}
+
+	country, ok := c.lookup(req.Country)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Country not found"})
+		return
+	}
+
+	// Without an explicit grade, a correct answer counts as a good recall
+	// and a wrong one as a failed recall
+	grade := 1
+	if req.Correct {
+		grade = 4
+	}
+	if req.Grade != nil {
+		grade = *req.Grade
+	}
+
+	practiceMu.Lock()
+	defer practiceMu.Unlock()
+
+	cards, err := practiceHistory(playerID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to load practice history: " + err.Error()})
+		return
+	}
+
+	card, ok := cards[country.ISO2]
+	if !ok {
+		card = game.NewPracticeCard(country.ISO2)
+		cards[country.ISO2] = card
+	}
+	card.Review(grade, time.Now())
+	savePracticeHistory(playerID, cards)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"card":    card,
+		"mastery": card.Mastery(),
+	})
+}
+
+// practiceMasteryHandler reports how well the player knows each country
+// and each region.
+//
+// HTTP Method: GET
+// Headers:
+//   - X-Identity-Token: Guest identity token, for clients without the
+//     guest identity cookie
+//
+// Response:
+//   - 200: Mastery per country and per region
+//   - 400: Invalid player ID
+func practiceMasteryHandler(w http.ResponseWriter, r *http.Request) {
+	playerID := requestPlayerID(r)
+	if !playerIDPattern.MatchString(playerID) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: errInvalidPlayerID.Error()})
+		return
+	}
+
+	c, err := getCatalog()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to load countries: " + err.Error()})
+		return
+	}
+
+	practiceMu.Lock()
+	defer practiceMu.Unlock()
+
+	cards, err := practiceHistory(playerID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to load practice history: " + err.Error()})
+		return
+	}
+
+	type regionMastery struct {
+		Region    string         `json:"region"`
+		Countries int            `json:"countries"`
+		Attempts  int            `json:"attempts"`
+		Correct   int            `json:"correct"`
+		Accuracy  float64        `json:"accuracy"`
+		Levels    map[string]int `json:"levels"`
+	}
+
+	now := time.Now()
+	countries := []map[string]interface{}{}
+	regions := make(map[string]*regionMastery)
+	for _, country := range c.countries {
+		card, ok := cards[country.ISO2]
+		if !ok {
+			card = game.NewPracticeCard(country.ISO2)
+		}
+
+		entry := map[string]interface{}{
+			"iso2":     country.ISO2,
+			"name":     country.Name,
+			"region":   country.Continent,
+			"attempts": card.Attempts,
+			"correct":  card.Correct,
+			"accuracy": card.Accuracy(),
+			"mastery":  card.Mastery(),
+			"due":      card.IsDue(now),
+		}
+		if card.Attempts > 0 {
+			entry["nextReview"] = card.Due
+		}
+		countries = append(countries, entry)
+
+		region, ok := regions[country.Continent]
+		if !ok {
+			region = &regionMastery{Region: country.Continent, Levels: make(map[string]int)}
+			regions[country.Continent] = region
+		}
+		region.Countries++
+		region.Attempts += card.Attempts
+		region.Correct += card.Correct
+		region.Levels[card.Mastery()]++
+	}
+
+	regionList := []*regionMastery{}
+	for _, name := range sortedKeys(regions) {
+		region := regions[name]
+		if region.Attempts > 0 {
+			region.Accuracy = float64(region.Correct) / float64(region.Attempts)
+		}
+		regionList = append(regionList, region)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"countries": countries,
+		"regions":   regionList,
+	})
+}
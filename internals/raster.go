@@ -0,0 +1,756 @@
+package internals
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Flags are compared and analysed on a coarse grid of colour samples
+// rather than rendered images. The grid is sized for the common 3:2 ratio;
+// other ratios are stretched to fit.
+const (
+	rasterWidth  = 24
+	rasterHeight = 16
+)
+
+// flagRaster holds the colour seen at the centre of each grid cell, as
+// "#rrggbb", or "" where nothing is painted.
+type flagRaster [rasterHeight][rasterWidth]string
+
+// svgNode is an element of a parsed SVG document.
+type svgNode struct {
+	name     string
+	attrs    map[string]string
+	children []*svgNode
+}
+
+// affine is a 2D transform matrix [a b c d e f] as used by SVG.
+type affine [6]float64
+
+var identity = affine{1, 0, 0, 1, 0, 0}
+
+type point struct{ x, y float64 }
+
+// shape is a painted element flattened to polylines in its own coordinates.
+type shape struct {
+	subpaths    [][]point
+	closed      []bool
+	fill        string
+	evenOdd     bool
+	stroke      string
+	strokeWidth float64
+	inverse     affine
+	min, max    point // bounds, including the stroke
+}
+
+// paintStyle is the inherited presentation state while walking the tree.
+type paintStyle struct {
+	fill        string
+	fillRule    string
+	stroke      string
+	strokeWidth float64
+	transform   affine
+}
+
+var (
+	pathTokenPattern = regexp.MustCompile(`[MmLlHhVvCcSsQqTtAaZz]|[-+]?(?:\d*\.\d+|\d+\.?)(?:[eE][-+]?\d+)?`)
+	numberPattern    = regexp.MustCompile(`[-+]?(?:\d*\.\d+|\d+\.?)(?:[eE][-+]?\d+)?`)
+	transformPattern = regexp.MustCompile(`(matrix|translate|scale|rotate|skewX|skewY)\s*\(([^)]*)\)`)
+	rgbPattern       = regexp.MustCompile(`^rgb\(\s*(\d+)\s*,\s*(\d+)\s*,\s*(\d+)\s*\)$`)
+)
+
+// namedColors covers the colour keywords used by the flags.
+var namedColors = map[string]string{
+	"black":  "#000000",
+	"white":  "#ffffff",
+	"red":    "#ff0000",
+	"green":  "#008000",
+	"blue":   "#0000ff",
+	"yellow": "#ffff00",
+	"gold":   "#ffd700",
+	"orange": "#ffa500",
+	"gray":   "#808080",
+	"grey":   "#808080",
+	"silver": "#c0c0c0",
+	"navy":   "#000080",
+	"maroon": "#800000",
+	"purple": "#800080",
+	"brown":  "#a52a2a",
+	"lime":   "#00ff00",
+	"aqua":   "#00ffff",
+	"cyan":   "#00ffff",
+}
+
+// normalizeColor converts an SVG colour to "#rrggbb". Paints that are not
+// a plain colour, such as gradients and "none", return "".
+func normalizeColor(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if named, ok := namedColors[value]; ok {
+		return named
+	}
+
+	if match := rgbPattern.FindStringSubmatch(value); match != nil {
+		rgb := make([]int, 3)
+		for i := range rgb {
+			rgb[i], _ = strconv.Atoi(match[i+1])
+			rgb[i] = min(rgb[i], 255)
+		}
+		return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+	}
+
+	if !strings.HasPrefix(value, "#") {
+		return ""
+	}
+	hex := value[1:]
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return ""
+	}
+	if _, err := strconv.ParseUint(hex, 16, 32); err != nil {
+		return ""
+	}
+	return "#" + hex
+}
+
+// colorDistance is the euclidean distance between two "#rrggbb" colours.
+func colorDistance(a, b string) float64 {
+	ra, ga, ba := rgbComponents(a)
+	rb, gb, bb := rgbComponents(b)
+	return math.Sqrt(float64((ra-rb)*(ra-rb) + (ga-gb)*(ga-gb) + (ba-bb)*(ba-bb)))
+}
+
+func rgbComponents(color string) (r, g, b int) {
+	v, _ := strconv.ParseUint(strings.TrimPrefix(color, "#"), 16, 32)
+	return int(v >> 16 & 0xff), int(v >> 8 & 0xff), int(v & 0xff)
+}
+
+// similarColors reports whether two samples would look the same to a
+// player. Flags drawn by different authors rarely use identical shades.
+func similarColors(a, b string) bool {
+	if a == "" || b == "" {
+		return a == b
+	}
+	return colorDistance(a, b) < 80
+}
+
+// similarity returns the share of grid cells where both rasters show a
+// similar colour.
+func (r *flagRaster) similarity(other *flagRaster) float64 {
+	same := 0
+	for y := range r {
+		for x := range r[y] {
+			if similarColors(r[y][x], other[y][x]) {
+				same++
+			}
+		}
+	}
+	return float64(same) / float64(rasterWidth*rasterHeight)
+}
+
+// rasterizeSVG samples the colours of an SVG flag on the raster grid.
+// It understands the shapes, paths, groups, transforms and <use> references
+// the flags are drawn with; gradients, masks and clip paths are ignored,
+// so the result is an approximation.
+func rasterizeSVG(data []byte) (*flagRaster, error) {
+	root, err := parseSVG(data)
+	if err != nil {
+		return nil, err
+	}
+
+	rootTag := svgRootPattern.Find(data)
+	if rootTag == nil {
+		return nil, errors.New("no svg root element")
+	}
+	x, y, width, height, err := parseViewBox(string(rootTag))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &rasterizer{ids: make(map[string]*svgNode), width: width, height: height}
+	indexIDs(root, r.ids)
+	r.collectShapes(root, paintStyle{fill: "#000000", transform: identity, strokeWidth: 1}, 0)
+
+	var raster flagRaster
+	for row := 0; row < rasterHeight; row++ {
+		for col := 0; col < rasterWidth; col++ {
+			p := point{
+				x: x + (float64(col)+0.5)/rasterWidth*width,
+				y: y + (float64(row)+0.5)/rasterHeight*height,
+			}
+			raster[row][col] = sampleShapes(r.shapes, p)
+		}
+	}
+	return &raster, nil
+}
+
+func parseSVG(data []byte) (*svgNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+
+	var root *svgNode
+	var stack []*svgNode
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if root != nil && len(stack) == 0 {
+				return root, nil
+			}
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &svgNode{name: t.Name.Local, attrs: make(map[string]string)}
+			for _, attr := range t.Attr {
+				node.attrs[attr.Name.Local] = attr.Value
+			}
+			if len(stack) == 0 {
+				root = node
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 && root != nil {
+				return root, nil
+			}
+		}
+	}
+}
+
+func indexIDs(node *svgNode, ids map[string]*svgNode) {
+	if id := node.attrs["id"]; id != "" {
+		ids[id] = node
+	}
+	for _, child := range node.children {
+		indexIDs(child, ids)
+	}
+}
+
+// Elements whose content is only drawn when referenced or not drawn at all.
+var skippedElements = map[string]bool{
+	"defs": true, "clipPath": true, "mask": true, "pattern": true, "symbol": true,
+	"linearGradient": true, "radialGradient": true, "marker": true,
+	"title": true, "desc": true, "metadata": true, "style": true,
+}
+
+// maxUseDepth stops runaway recursion through <use> references.
+const maxUseDepth = 8
+
+// rasterizer flattens an SVG document to the shapes it paints.
+type rasterizer struct {
+	ids    map[string]*svgNode
+	width  float64 // of the viewBox, for percentage lengths
+	height float64
+	shapes []shape
+}
+
+func (r *rasterizer) collectShapes(node *svgNode, style paintStyle, depth int) {
+	style = applyPresentation(node, style)
+
+	switch node.name {
+	case "use":
+		href := node.attrs["href"]
+		target, ok := r.ids[strings.TrimPrefix(href, "#")]
+		if !ok || depth >= maxUseDepth {
+			return
+		}
+		offset := affine{1, 0, 0, 1, r.length(node, "x"), r.length(node, "y")}
+		style.transform = style.transform.multiply(offset)
+		r.collectShapes(target, style, depth+1)
+		return
+	case "rect", "circle", "ellipse", "line", "polyline", "polygon", "path":
+		subpaths, closed := r.shapeGeometry(node)
+		if len(subpaths) == 0 {
+			return
+		}
+		s := shape{
+			subpaths:    subpaths,
+			closed:      closed,
+			fill:        normalizeColor(style.fill),
+			evenOdd:     style.fillRule == "evenodd",
+			stroke:      normalizeColor(style.stroke),
+			strokeWidth: style.strokeWidth,
+			inverse:     style.transform.inverse(),
+		}
+		s.min, s.max = bounds(subpaths, s.strokeWidth/2)
+		if node.name == "line" || node.name == "polyline" {
+			s.fill = ""
+		}
+		if s.fill != "" || s.stroke != "" {
+			r.shapes = append(r.shapes, s)
+		}
+		return
+	}
+
+	for _, child := range node.children {
+		if skippedElements[child.name] {
+			continue
+		}
+		r.collectShapes(child, style, depth)
+	}
+}
+
+// applyPresentation returns the style inherited by node's content.
+func applyPresentation(node *svgNode, style paintStyle) paintStyle {
+	props := map[string]string{}
+	for _, name := range []string{"fill", "fill-rule", "stroke", "stroke-width"} {
+		if value, ok := node.attrs[name]; ok {
+			props[name] = value
+		}
+	}
+	for _, declaration := range strings.Split(node.attrs["style"], ";") {
+		name, value, ok := strings.Cut(declaration, ":")
+		if ok {
+			props[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+
+	if value, ok := props["fill"]; ok && value != "inherit" {
+		style.fill = value
+	}
+	if value, ok := props["fill-rule"]; ok && value != "inherit" {
+		style.fillRule = value
+	}
+	if value, ok := props["stroke"]; ok && value != "inherit" {
+		style.stroke = value
+	}
+	if value, ok := props["stroke-width"]; ok {
+		if width, err := strconv.ParseFloat(strings.TrimSuffix(value, "px"), 64); err == nil {
+			style.strokeWidth = width
+		}
+	}
+	if transform, ok := node.attrs["transform"]; ok {
+		style.transform = style.transform.multiply(parseTransform(transform))
+	}
+	return style
+}
+
+// length returns a length attribute in user units. Percentages are
+// relative to the viewBox, as they are for the flags' root viewport.
+func (r *rasterizer) length(node *svgNode, name string) float64 {
+	value := strings.TrimSpace(node.attrs[name])
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		v, _ := strconv.ParseFloat(percent, 64)
+		switch name {
+		case "x", "width", "cx", "rx", "x1", "x2":
+			return v / 100 * r.width
+		case "y", "height", "cy", "ry", "y1", "y2":
+			return v / 100 * r.height
+		default:
+			return v / 100 * math.Hypot(r.width, r.height) / math.Sqrt2
+		}
+	}
+	v, _ := strconv.ParseFloat(strings.TrimSuffix(value, "px"), 64)
+	return v
+}
+
+// shapeGeometry flattens a shape element to polylines.
+func (r *rasterizer) shapeGeometry(node *svgNode) ([][]point, []bool) {
+	switch node.name {
+	case "rect":
+		x, y := r.length(node, "x"), r.length(node, "y")
+		w, h := r.length(node, "width"), r.length(node, "height")
+		if w <= 0 || h <= 0 {
+			return nil, nil
+		}
+		return [][]point{{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}}, []bool{true}
+	case "circle":
+		radius := r.length(node, "r")
+		return [][]point{ellipsePoints(r.length(node, "cx"), r.length(node, "cy"), radius, radius)}, []bool{true}
+	case "ellipse":
+		return [][]point{ellipsePoints(r.length(node, "cx"), r.length(node, "cy"), r.length(node, "rx"), r.length(node, "ry"))}, []bool{true}
+	case "line":
+		return [][]point{{{r.length(node, "x1"), r.length(node, "y1")}, {r.length(node, "x2"), r.length(node, "y2")}}}, []bool{false}
+	case "polyline", "polygon":
+		values := parseNumbers(node.attrs["points"])
+		var points []point
+		for i := 0; i+1 < len(values); i += 2 {
+			points = append(points, point{values[i], values[i+1]})
+		}
+		return [][]point{points}, []bool{node.name == "polygon"}
+	case "path":
+		return parsePath(node.attrs["d"])
+	}
+	return nil, nil
+}
+
+func ellipsePoints(cx, cy, rx, ry float64) []point {
+	const segments = 32
+	points := make([]point, segments)
+	for i := range points {
+		angle := 2 * math.Pi * float64(i) / segments
+		points[i] = point{cx + rx*math.Cos(angle), cy + ry*math.Sin(angle)}
+	}
+	return points
+}
+
+func parseNumbers(s string) []float64 {
+	var values []float64
+	for _, token := range numberPattern.FindAllString(s, -1) {
+		if v, err := strconv.ParseFloat(token, 64); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// pathArgs is the number of arguments each path command takes.
+var pathArgs = map[byte]int{
+	'M': 2, 'L': 2, 'H': 1, 'V': 1, 'C': 6, 'S': 4, 'Q': 4, 'T': 2, 'A': 7, 'Z': 0,
+}
+
+// parsePath flattens path data to polylines. Curves are approximated by a
+// few points along them, which is plenty for the raster grid.
+func parsePath(d string) ([][]point, []bool) {
+	tokens := pathTokenPattern.FindAllString(d, -1)
+
+	var subpaths [][]point
+	var closed []bool
+	var current []point
+	var pos, start, control point
+	var command byte
+
+	flush := func(close bool) {
+		if len(current) > 1 {
+			subpaths = append(subpaths, current)
+			closed = append(closed, close)
+		}
+		current = nil
+	}
+
+	lineTo := func(p point) {
+		if len(current) == 0 {
+			current = append(current, pos)
+		}
+		current = append(current, p)
+		pos = p
+	}
+
+	for i := 0; i < len(tokens); {
+		if c := tokens[i][0]; strings.ContainsRune("MmLlHhVvCcSsQqTtAaZz", rune(c)) {
+			command = c
+			i++
+			if command == 'Z' || command == 'z' {
+				flush(true)
+				pos = start
+				continue
+			}
+		}
+		if command == 0 {
+			return subpaths, closed
+		}
+
+		upper := command &^ 0x20
+		n := pathArgs[upper]
+		if n == 0 {
+			// Stray numbers after a close path command
+			i++
+			continue
+		}
+		if i+n > len(tokens) {
+			break
+		}
+		args := make([]float64, n)
+		for j := range args {
+			v, err := strconv.ParseFloat(tokens[i+j], 64)
+			if err != nil {
+				return subpaths, closed
+			}
+			args[j] = v
+		}
+		i += n
+
+		relative := command != upper
+		abs := func(x, y float64) point {
+			if relative {
+				return point{pos.x + x, pos.y + y}
+			}
+			return point{x, y}
+		}
+
+		switch upper {
+		case 'M':
+			flush(false)
+			pos = abs(args[0], args[1])
+			start = pos
+			current = []point{pos}
+			// Further coordinate pairs are implicit line commands
+			if relative {
+				command = 'l'
+			} else {
+				command = 'L'
+			}
+		case 'L', 'T':
+			lineTo(abs(args[0], args[1]))
+		case 'H':
+			x := args[0]
+			if relative {
+				x += pos.x
+			}
+			lineTo(point{x, pos.y})
+		case 'V':
+			y := args[0]
+			if relative {
+				y += pos.y
+			}
+			lineTo(point{pos.x, y})
+		case 'C':
+			p0, p1, p2, p3 := pos, abs(args[0], args[1]), abs(args[2], args[3]), abs(args[4], args[5])
+			for _, t := range []float64{0.25, 0.5, 0.75, 1} {
+				lineTo(cubicPoint(p0, p1, p2, p3, t))
+			}
+			control = p2
+		case 'S':
+			p0 := pos
+			p1 := point{2*pos.x - control.x, 2*pos.y - control.y}
+			p2, p3 := abs(args[0], args[1]), abs(args[2], args[3])
+			for _, t := range []float64{0.25, 0.5, 0.75, 1} {
+				lineTo(cubicPoint(p0, p1, p2, p3, t))
+			}
+			control = p2
+		case 'Q':
+			p0, p1, p2 := pos, abs(args[0], args[1]), abs(args[2], args[3])
+			for _, t := range []float64{0.25, 0.5, 0.75, 1} {
+				lineTo(cubicPoint(p0, p1, p1, p2, t))
+			}
+		case 'A':
+			end := abs(args[5], args[6])
+			for _, p := range arcPoints(pos, end, args[0], args[1], args[2], args[3] != 0, args[4] != 0) {
+				lineTo(p)
+			}
+		}
+		if upper != 'C' && upper != 'S' {
+			control = pos
+		}
+	}
+
+	flush(false)
+	return subpaths, closed
+}
+
+func cubicPoint(p0, p1, p2, p3 point, t float64) point {
+	u := 1 - t
+	return point{
+		u*u*u*p0.x + 3*u*u*t*p1.x + 3*u*t*t*p2.x + t*t*t*p3.x,
+		u*u*u*p0.y + 3*u*u*t*p1.y + 3*u*t*t*p2.y + t*t*t*p3.y,
+	}
+}
+
+// arcPoints approximates an elliptical arc by points along it, following
+// the endpoint to centre conversion of the SVG specification.
+func arcPoints(from, to point, rx, ry, rotation float64, largeArc, sweep bool) []point {
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 || from == to {
+		return []point{to}
+	}
+
+	phi := rotation * math.Pi / 180
+	cos, sin := math.Cos(phi), math.Sin(phi)
+	dx, dy := (from.x-to.x)/2, (from.y-to.y)/2
+	x1 := cos*dx + sin*dy
+	y1 := -sin*dx + cos*dy
+
+	// Scale up radii that are too small to reach the end point
+	if lambda := x1*x1/(rx*rx) + y1*y1/(ry*ry); lambda > 1 {
+		rx *= math.Sqrt(lambda)
+		ry *= math.Sqrt(lambda)
+	}
+
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	factor := math.Sqrt(math.Max(0, num/den))
+	if largeArc == sweep {
+		factor = -factor
+	}
+	cx1 := factor * rx * y1 / ry
+	cy1 := -factor * ry * x1 / rx
+	cx := cos*cx1 - sin*cy1 + (from.x+to.x)/2
+	cy := sin*cx1 + cos*cy1 + (from.y+to.y)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta := angle(1, 0, (x1-cx1)/rx, (y1-cy1)/ry)
+	delta := angle((x1-cx1)/rx, (y1-cy1)/ry, (-x1-cx1)/rx, (-y1-cy1)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	const segments = 8
+	points := make([]point, 0, segments)
+	for i := 1; i <= segments; i++ {
+		t := theta + delta*float64(i)/segments
+		x, y := rx*math.Cos(t), ry*math.Sin(t)
+		points = append(points, point{cos*x - sin*y + cx, sin*x + cos*y + cy})
+	}
+	points[len(points)-1] = to
+	return points
+}
+
+func parseTransform(s string) affine {
+	result := identity
+	for _, match := range transformPattern.FindAllStringSubmatch(s, -1) {
+		args := parseNumbers(match[2])
+		arg := func(i int, fallback float64) float64 {
+			if i < len(args) {
+				return args[i]
+			}
+			return fallback
+		}
+
+		var m affine
+		switch match[1] {
+		case "matrix":
+			if len(args) != 6 {
+				continue
+			}
+			copy(m[:], args)
+		case "translate":
+			m = affine{1, 0, 0, 1, arg(0, 0), arg(1, 0)}
+		case "scale":
+			sx := arg(0, 1)
+			m = affine{sx, 0, 0, arg(1, sx), 0, 0}
+		case "rotate":
+			a := arg(0, 0) * math.Pi / 180
+			cx, cy := arg(1, 0), arg(2, 0)
+			m = affine{1, 0, 0, 1, cx, cy}.
+				multiply(affine{math.Cos(a), math.Sin(a), -math.Sin(a), math.Cos(a), 0, 0}).
+				multiply(affine{1, 0, 0, 1, -cx, -cy})
+		case "skewX":
+			m = affine{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			m = affine{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		}
+		result = result.multiply(m)
+	}
+	return result
+}
+
+// multiply returns m applied after n, i.e. the matrix product m·n.
+func (m affine) multiply(n affine) affine {
+	return affine{
+		m[0]*n[0] + m[2]*n[1],
+		m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3],
+		m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4],
+		m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+func (m affine) inverse() affine {
+	det := m[0]*m[3] - m[1]*m[2]
+	if det == 0 {
+		return affine{}
+	}
+	return affine{
+		m[3] / det,
+		-m[1] / det,
+		-m[2] / det,
+		m[0] / det,
+		(m[2]*m[5] - m[3]*m[4]) / det,
+		(m[1]*m[4] - m[0]*m[5]) / det,
+	}
+}
+
+func (m affine) apply(p point) point {
+	return point{m[0]*p.x + m[2]*p.y + m[4], m[1]*p.x + m[3]*p.y + m[5]}
+}
+
+// sampleShapes returns the colour of the topmost shape painted at p.
+func sampleShapes(shapes []shape, p point) string {
+	for i := len(shapes) - 1; i >= 0; i-- {
+		s := &shapes[i]
+		q := s.inverse.apply(p)
+		if q.x < s.min.x || q.x > s.max.x || q.y < s.min.y || q.y > s.max.y {
+			continue
+		}
+		if s.stroke != "" && s.strokeWidth > 0 && onStroke(s, q) {
+			return s.stroke
+		}
+		if s.fill != "" && insideFill(s, q) {
+			return s.fill
+		}
+	}
+	return ""
+}
+
+func bounds(subpaths [][]point, margin float64) (point, point) {
+	lo := point{math.Inf(1), math.Inf(1)}
+	hi := point{math.Inf(-1), math.Inf(-1)}
+	for _, path := range subpaths {
+		for _, p := range path {
+			lo = point{math.Min(lo.x, p.x), math.Min(lo.y, p.y)}
+			hi = point{math.Max(hi.x, p.x), math.Max(hi.y, p.y)}
+		}
+	}
+	return point{lo.x - margin, lo.y - margin}, point{hi.x + margin, hi.y + margin}
+}
+
+// insideFill tests p against all subpaths together, using the shape's
+// fill rule.
+func insideFill(s *shape, p point) bool {
+	winding := 0
+	for _, path := range s.subpaths {
+		for i := range path {
+			a, b := path[i], path[(i+1)%len(path)]
+			if a.y <= p.y {
+				if b.y > p.y && cross(a, b, p) > 0 {
+					winding++
+				}
+			} else if b.y <= p.y && cross(a, b, p) < 0 {
+				winding--
+			}
+		}
+	}
+	if s.evenOdd {
+		return winding%2 != 0
+	}
+	return winding != 0
+}
+
+func cross(a, b, p point) float64 {
+	return (b.x-a.x)*(p.y-a.y) - (p.x-a.x)*(b.y-a.y)
+}
+
+func onStroke(s *shape, p point) bool {
+	half := s.strokeWidth / 2
+	for i, path := range s.subpaths {
+		segments := len(path) - 1
+		if s.closed[i] {
+			segments = len(path)
+		}
+		for j := 0; j < segments; j++ {
+			if segmentDistance(p, path[j], path[(j+1)%len(path)]) <= half {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func segmentDistance(p, a, b point) float64 {
+	dx, dy := b.x-a.x, b.y-a.y
+	lengthSquared := dx*dx + dy*dy
+	t := 0.0
+	if lengthSquared > 0 {
+		t = math.Max(0, math.Min(1, ((p.x-a.x)*dx+(p.y-a.y)*dy)/lengthSquared))
+	}
+	return math.Hypot(p.x-(a.x+t*dx), p.y-(a.y+t*dy))
+}
@@ -0,0 +1,221 @@
+package internals
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+	"github.com/gorilla/mux"
+)
+
+// profilesMu serialises rating updates, which read and write profiles.
+var profilesMu sync.Mutex
+
+func saveProfile(profile *game.Profile) {
+	if err := dataStore.SaveProfile(profile); err != nil {
+		log.Printf("Failed to save profile %s: %v", profile.ID, err)
+	}
+}
+
+// playerRating returns the rating of a player, or the default rating for
+// players without a profile.
+func playerRating(id string) int {
+	if id == "" {
+		return game.DefaultRating
+	}
+
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+
+	profile, err := dataStore.Profile(id)
+	if err != nil || profile == nil {
+		return game.DefaultRating
+	}
+	return profile.Rating
+}
+
+// isRatedResult reports whether a game ended in a way that counts toward
+// ratings. Games cut short by a shutdown do not.
+func isRatedResult(reason string) bool {
+	return reason == "completed" || reason == "time_over"
+}
+
+// placements ranks the standings of a result for rating. Players tied on
+// score share a place; in team games everyone takes their team's place.
+func placements(result *game.Result) []int {
+	ranks := make([]int, len(result.Standings))
+
+	if len(result.Teams) > 0 {
+		teamRanks := make(map[int]int, len(result.Teams))
+		for i, team := range result.Teams {
+			teamRanks[team.Team] = i + 1
+			if i > 0 && team.Score == result.Teams[i-1].Score {
+				teamRanks[team.Team] = teamRanks[result.Teams[i-1].Team]
+			}
+		}
+		for i, standing := range result.Standings {
+			ranks[i] = teamRanks[standing.Team]
+		}
+		return ranks
+	}
+
+	for i, standing := range result.Standings {
+		ranks[i] = i + 1
+		if i > 0 {
+			previous := result.Standings[i-1]
+			if standing.Score == previous.Score && standing.Eliminated == previous.Eliminated {
+				ranks[i] = ranks[i-1]
+			}
+		}
+	}
+	return ranks
+}
+
+// applyRatings updates the profiles of the rated players of a finished game
+// and records the changes on their standings. Players without a profile ID
+// are left out, and nothing is rated unless at least two players are left.
+func applyRatings(result *game.Result) {
+	if !isRatedResult(result.Reason) {
+		return
+	}
+
+	ranks := placements(result)
+
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+
+	// A profile playing from several connections counts once, at its
+	// best place
+	var rated []int
+	var ratedProfiles []*game.Profile
+	seen := make(map[string]bool)
+	for i, standing := range result.Standings {
+		if standing.ProfileID == "" || seen[standing.ProfileID] {
+			continue
+		}
+		seen[standing.ProfileID] = true
+
+		profile, err := dataStore.Profile(standing.ProfileID)
+		if err != nil {
+			log.Printf("Failed to load profile %s: %v", standing.ProfileID, err)
+			continue
+		}
+		if profile == nil {
+			profile = game.NewProfile(standing.ProfileID)
+		}
+		rated = append(rated, i)
+		ratedProfiles = append(ratedProfiles, profile)
+	}
+
+	if len(rated) < 2 {
+		return
+	}
+
+	players := make([]game.Placement, len(rated))
+	for k, i := range rated {
+		players[k] = game.Placement{
+			Rating: ratedProfiles[k].Rating,
+			Games:  ratedProfiles[k].Games,
+			Rank:   ranks[i],
+		}
+	}
+	changes := game.UpdateRatings(players)
+
+	for k, i := range rated {
+		profile := ratedProfiles[k]
+		standing := &result.Standings[i]
+		standing.Rating = &game.RatingChange{
+			Before: profile.Rating,
+			After:  profile.Rating + changes[k],
+			Change: changes[k],
+		}
+
+		profile.Username = standing.Username
+		profile.Rating += changes[k]
+		profile.Games++
+		if ranks[i] == 1 {
+			profile.Wins++
+		}
+		profile.UpdatedAt = result.EndedAt
+		saveProfile(profile)
+	}
+}
+
+// ratingUpdates lists the rating changes of a result for the final results
+// events, or nil when there is no result or the game was not rated.
+func ratingUpdates(result *game.Result) []map[string]interface{} {
+	if result == nil {
+		return nil
+	}
+
+	var updates []map[string]interface{}
+	for _, standing := range result.Standings {
+		if standing.Rating == nil {
+			continue
+		}
+		updates = append(updates, map[string]interface{}{
+			"player_id":     standing.PlayerID,
+			"username":      standing.Username,
+			"rating":        standing.Rating.After,
+			"rating_change": standing.Rating.Change,
+		})
+	}
+	return updates
+}
+
+// profileHandler returns a player's profile.
+//
+// HTTP Method: GET
+// Path Parameter:
+//   - id: Player identifier, see identityHandler
+//
+// Response:
+//   - 200: The player's rating, rated games and wins
+//   - 400: Invalid player identifier
+//   - 404: The player has not played a rated game
+//   - 500: Profile could not be read
+func profileHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if !playerIDPattern.MatchString(id) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid player ID"})
+		return
+	}
+
+	profilesMu.Lock()
+	profile, err := dataStore.Profile(id)
+	var view map[string]interface{}
+	if profile != nil {
+		view = map[string]interface{}{
+			"id":          profile.ID,
+			"username":    profile.Username,
+			"rating":      profile.Rating,
+			"provisional": profile.Provisional(),
+			"games":       profile.Games,
+			"wins":        profile.Wins,
+			"updated_at":  profile.UpdatedAt.Format(time.RFC3339),
+		}
+	}
+	profilesMu.Unlock()
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to read profile: " + err.Error()})
+		return
+	}
+
+	if view == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Profile not found"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
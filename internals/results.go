@@ -0,0 +1,93 @@
+package internals
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// buildResult captures the final standings of a room, ordered by score.
+func buildResult(room *game.Room, reason string) game.Result {
+	standings := []game.Standing{}
+	for _, player := range roomPlayers(room) {
+		if player == nil {
+			continue
+		}
+		standings = append(standings, game.Standing{
+			PlayerID:   player.ID,
+			Username:   player.Username,
+			Score:      player.Score,
+			BestStreak: player.BestStreak,
+			Completed:  player.Completed,
+			Eliminated: player.Eliminated,
+			Team:       player.Team,
+			ProfileID:  player.ProfileID,
+		})
+	}
+
+	// Survivors always place above eliminated players
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Eliminated != standings[j].Eliminated {
+			return !standings[i].Eliminated
+		}
+		return standings[i].Score > standings[j].Score
+	})
+
+	for i := range standings {
+		standings[i].Rank = i + 1
+	}
+
+	return game.Result{
+		RoomCode:     room.Code,
+		GameMode:     room.GameMode,
+		Region:       room.Region,
+		NumQuestions: len(room.Questions),
+		Standings:    standings,
+		Teams:        teamStandings(room),
+		Winner:       room.Winner,
+		Reason:       reason,
+		EndedAt:      time.Now(),
+	}
+}
+
+// markFinished marks a started room as finished. It reports whether the
+// caller is the one who finished it, so that a game ending several ways at
+// once, such as the last two answers arriving together, is only recorded
+// once. Rooms that never left the lobby are not marked.
+func markFinished(room *game.Room) bool {
+	room.Lock()
+	defer room.Unlock()
+
+	if !room.Start || room.Finished {
+		return false
+	}
+	room.Finished = true
+	return true
+}
+
+// recordResult rates and stores the final standings of a started room
+// exactly once, returning nil if they were already recorded. Rooms that
+// never left the lobby have nothing worth recording.
+func recordResult(room *game.Room, reason string) *game.Result {
+	if !markFinished(room) {
+		return nil
+	}
+	return storeResult(room, reason)
+}
+
+// storeResult rates and stores the final standings of a room the caller
+// has marked finished.
+func storeResult(room *game.Room, reason string) *game.Result {
+	result := buildResult(room, reason)
+	applyRatings(&result)
+	if err := dataStore.AddResult(result); err != nil {
+		log.Printf("Failed to persist results for room %s: %v", room.Code, err)
+	}
+	addToLeaderboards(&result)
+
+	// The game is accounted for, there is nothing left to recover
+	forgetRoom(room.Code)
+	return &result
+}
@@ -1,6 +1,8 @@
 package internals
 
 import (
+	"io/fs"
+	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -9,10 +11,14 @@ import (
 func Router() *mux.Router {
 	r := mux.NewRouter()
 	// r.Use(loggingMiddleware)
+	r.Use(identityMiddleware)
 
 	// Serve static files under "/static" URL path
-	fs := http.FileServer(http.Dir("./frontend/static"))
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", fs))
+	static, err := fs.Sub(assets, "frontend/static")
+	if err != nil {
+		log.Fatal("Failed to load static assets: ", err)
+	}
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.FS(static))))
 
 	// WebSocket endpoint for "/ws"
 	r.HandleFunc("/ws", HandleWebSocket)
@@ -22,39 +28,25 @@ func Router() *mux.Router {
 	//
 
 	// "/"
-	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./frontend/index.html")
-	})
+	r.HandleFunc("/", servePage("frontend/index.html"))
 
 	// "/"
-	r.HandleFunc("/admin", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./frontend/admin.html")
-	})
+	r.HandleFunc("/admin", servePage("frontend/admin.html"))
 
 	// "/joinroom"
-	r.HandleFunc("/joinroom", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./frontend/game.joinroom.html")
-	})
+	r.HandleFunc("/joinroom", servePage("frontend/game.joinroom.html"))
 
 	// "/createroom"
-	r.HandleFunc("/createroom", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./frontend/game.createroom.html")
-	})
+	r.HandleFunc("/createroom", servePage("frontend/game.createroom.html"))
 
 	// "/room?id={id}"
-	r.HandleFunc("/room", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./frontend/game.room.html")
-	})
+	r.HandleFunc("/room", servePage("frontend/game.room.html"))
 
 	// "/play" Single player game
-	r.HandleFunc("/play", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./frontend/game.singleplayer.html")
-	})
+	r.HandleFunc("/play", servePage("frontend/game.singleplayer.html"))
 
 	// "/map" Single player game
-	r.HandleFunc("/map", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./frontend/worldmap.html")
-	})
+	r.HandleFunc("/map", servePage("frontend/worldmap.html"))
 
 	// game state
 	r.HandleFunc("/api/singleplayer", SinglePlayerHandler).Methods("GET")
@@ -62,6 +54,43 @@ func Router() *mux.Router {
 	r.HandleFunc("/api/joinroom", joinRoomHandler).Methods("POST")
 	r.HandleFunc("/api/room/{id}", getRoomHandler).Methods("GET")
 	r.HandleFunc("/api/rooms", adminHandler).Methods("GET")
+	r.HandleFunc("/api/lobby", lobbyHandler).Methods("GET")
+	r.HandleFunc("/api/lobby/events", lobbyEventsHandler).Methods("GET")
+	r.HandleFunc("/api/matchmaking", matchmakingHandler).Methods("GET")
+	r.HandleFunc("/api/profiles/{id}", profileHandler).Methods("GET")
+	r.HandleFunc("/api/leaderboard", leaderboardHandler).Methods("GET")
+	r.HandleFunc("/api/leaderboard/{period}", leaderboardHandler).Methods("GET")
+	r.HandleFunc("/api/identity", identityHandler).Methods("GET", "POST")
+
+	// daily challenge
+	r.HandleFunc("/api/daily/answer", dailyAnswerHandler).Methods("POST")
+	r.HandleFunc("/api/daily/leaderboard", dailyLeaderboardHandler).Methods("GET")
+
+	// spaced-repetition practice
+	r.HandleFunc("/api/practice/review", practiceReviewHandler).Methods("POST")
+	r.HandleFunc("/api/practice/mastery", practiceMasteryHandler).Methods("GET")
+
+	// single-player zoom questions
+	r.HandleFunc("/api/zoom/{id}/fragment", zoomFragmentHandler).Methods("GET")
+	r.HandleFunc("/api/zoom/{id}/answer", zoomAnswerHandler).Methods("POST")
+
+	// neighbour chains
+	r.HandleFunc("/api/chain", startChainHandler).Methods("POST")
+	r.HandleFunc("/api/chain/{id}/answer", chainAnswerHandler).Methods("POST")
+
+	// marathon runs
+	r.HandleFunc("/api/marathon", startMarathonHandler).Methods("POST")
+	r.HandleFunc("/api/marathon/{id}", getMarathonHandler).Methods("GET")
+	r.HandleFunc("/api/marathon/{id}/answer", marathonAnswerHandler).Methods("POST")
+	r.HandleFunc("/api/marathon/{id}/summary", marathonSummaryHandler).Methods("GET")
+
+	// map data
+	r.HandleFunc("/api/geo", geoHandler).Methods("GET")
+
+	// country catalog
+	r.HandleFunc("/api/countries", countriesHandler).Methods("GET")
+	r.HandleFunc("/api/countries/{code}", countryHandler).Methods("GET")
+	r.HandleFunc("/api/flags/{code}/variant", flagVariantHandler).Methods("GET")
 
 	//
 	// Error handlers
@@ -70,7 +99,7 @@ func Router() *mux.Router {
 	// 404
 	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
-		http.ServeFile(w, r, "./frontend/404.html")
+		http.ServeFileFS(w, r, assets, "frontend/404.html")
 	})
 
 	return r
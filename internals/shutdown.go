@@ -0,0 +1,135 @@
+package internals
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+	"github.com/gorilla/websocket"
+)
+
+// shuttingDown is set once the server has started draining. While it is set
+// no new rooms can be created or joined and no new connections are taken.
+var shuttingDown atomic.Bool
+
+// ShutdownOptions controls how active rooms are drained on shutdown.
+type ShutdownOptions struct {
+	// Grace is the countdown announced to every room before connections
+	// are closed.
+	Grace time.Duration
+
+	// FinishGames lets in-flight games keep playing until they end on
+	// their own or the grace period expires. When false, started games are
+	// ended and recorded as soon as the shutdown begins, and their players
+	// are only kept connected to see the countdown.
+	FinishGames bool
+}
+
+// Shutdown stops accepting new rooms and connections, notifies every
+// active room with a "server_shutdown" countdown, records the results of
+// started games and closes all WebSocket connections. It returns once every
+// room is closed, the grace period has expired or ctx is done, whichever
+// comes first.
+func Shutdown(ctx context.Context, opts ShutdownOptions) {
+	shuttingDown.Store(true)
+	notifyLobby()
+
+	for _, room := range snapshotRooms() {
+		switch {
+		case !room.Start:
+			// Rooms still waiting in the lobby have no game to finish
+			closeRoom(room, "server_shutdown")
+		case !opts.FinishGames:
+			recordResult(room, "server_shutdown")
+		}
+	}
+
+	deadline := time.Now().Add(opts.Grace)
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		remaining := time.Until(deadline).Round(time.Second)
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		if notifyShutdown(remaining, opts.FinishGames) == 0 || remaining == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Shutdown deadline exceeded, closing remaining rooms")
+			closeAllRooms("server_shutdown")
+			return
+		case <-ticker.C:
+		}
+	}
+
+	closeAllRooms("server_shutdown")
+}
+
+// notifyShutdown sends the remaining countdown to every room and returns
+// the number of rooms it was sent to. When games are allowed to finish,
+// rooms whose game has ended are closed instead of waited for.
+func notifyShutdown(remaining time.Duration, finishGames bool) int {
+	active := 0
+	for _, room := range snapshotRooms() {
+		if finishGames && (room.Finished || allPlayersCompleted(room)) {
+			closeRoom(room, "completed")
+			continue
+		}
+
+		broadcastToRoom(room, map[string]interface{}{
+			"event": "server_shutdown",
+			"data": map[string]interface{}{
+				"seconds":      int(remaining.Seconds()),
+				"finish_games": finishGames,
+			},
+		})
+		active++
+	}
+	return active
+}
+
+func closeAllRooms(reason string) {
+	for _, room := range snapshotRooms() {
+		closeRoom(room, reason)
+	}
+}
+
+// snapshotRooms returns the currently registered rooms so that callers can
+// iterate without holding the lock while writing to connections.
+func snapshotRooms() []*game.Room {
+	mu.Lock()
+	defer mu.Unlock()
+
+	list := make([]*game.Room, 0, len(rooms))
+	for _, room := range rooms {
+		list = append(list, room)
+	}
+	return list
+}
+
+// closeRoom records the room's result, sends a close frame to every player
+// and removes the room from the registry.
+func closeRoom(room *game.Room, reason string) {
+	recordResult(room, reason)
+
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	for conn := range roomPlayers(room) {
+		conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+		conn.Close()
+	}
+	closeSpectators(room, reason)
+	stopGameTimer(room)
+
+	if unregisterRoom(room) {
+		forgetRoom(room.Code)
+	}
+	notifyLobby()
+}
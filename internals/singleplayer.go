@@ -2,19 +2,51 @@ package internals
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+
+	"github.com/adimail/fun-with-flags/internals/game"
 )
 
+// maxSinglePlayerQuestions bounds the questions asked for with the
+// X-Num-Questions header. Some modes, such as higher or lower, can build
+// any number of questions from the catalog.
+const maxSinglePlayerQuestions = 100
+
 func SinglePlayerHandler(w http.ResponseWriter, r *http.Request) {
+	gameType := r.Header.Get("game-type")
+	if gameType == "" {
+		gameType = game.GameTypeMCQ
+	}
+	if gameType == game.GameTypePractice {
+		practiceHandler(w, r)
+		return
+	}
+	if gameType == game.GameTypeDaily {
+		dailyHandler(w, r)
+		return
+	}
+	if !game.IsValidGameType(gameType) {
+		http.Error(w, "Unknown game type", http.StatusBadRequest)
+		return
+	}
+	if gameType == game.GameTypeNeighbourChain {
+		http.Error(w, "Neighbour chains are played through /api/chain", http.StatusBadRequest)
+		return
+	}
+
+	// Survival runs over the whole catalog, so the question count is optional
 	numQuestionsStr := r.Header.Get("X-Num-Questions")
 	numQuestions, err := strconv.Atoi(numQuestionsStr)
-	if err != nil || numQuestions <= 0 {
+	if !game.UsesWholeCatalog(gameType) && (err != nil || numQuestions <= 0) {
 		http.Error(w, "Invalid number of questions", http.StatusBadRequest)
 		return
 	}
-
-	gameType := r.Header.Get("game-type")
+	if !game.UsesWholeCatalog(gameType) && numQuestions > maxSinglePlayerQuestions {
+		http.Error(w, fmt.Sprintf("At most %d questions can be asked for", maxSinglePlayerQuestions), http.StatusBadRequest)
+		return
+	}
 
 	questions, err := generateQuestions(numQuestions, gameType)
 	if err != nil {
@@ -22,6 +54,48 @@ func SinglePlayerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Zoom questions stay on the server, the flag would give them away
+	if gameType == game.GameTypeZoom {
+		views, err := registerZoomQuestions(questions)
+		if err != nil {
+			http.Error(w, "Failed to generate questions: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(views)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(questions)
+}
+
+// practiceHandler serves a practice session for the player identified by
+// their guest identity, picking the flags they are due to review or weakest
+// on.
+func practiceHandler(w http.ResponseWriter, r *http.Request) {
+	playerID := requestPlayerID(r)
+	if !playerIDPattern.MatchString(playerID) {
+		http.Error(w, errInvalidPlayerID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	numQuestions, err := strconv.Atoi(r.Header.Get("X-Num-Questions"))
+	if err != nil || numQuestions <= 0 {
+		http.Error(w, "Invalid number of questions", http.StatusBadRequest)
+		return
+	}
+	if numQuestions > maxSinglePlayerQuestions {
+		http.Error(w, fmt.Sprintf("At most %d questions can be asked for", maxSinglePlayerQuestions), http.StatusBadRequest)
+		return
+	}
+
+	questions, err := generatePracticeQuestions(playerID, numQuestions)
+	if err != nil {
+		http.Error(w, "Failed to generate questions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(questions)
 }
@@ -0,0 +1,145 @@
+package internals
+
+import (
+	"log"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+	"github.com/gorilla/websocket"
+)
+
+// playerProgress describes where a player is in the game, as shown to
+// spectators.
+func playerProgress(room *game.Room, player *game.Player) map[string]interface{} {
+	progress := map[string]interface{}{
+		"id":             player.ID,
+		"username":       player.Username,
+		"score":          player.Score,
+		"question_index": player.QuestionIndex,
+		"completed":      player.Completed,
+		"eliminated":     player.Eliminated,
+	}
+	if room.Teams > 0 {
+		progress["team"] = player.Team
+	}
+	return progress
+}
+
+// roomSpectators returns a copy of the room's spectators, so callers can
+// range over them without holding the room lock while writing to
+// connections.
+func roomSpectators(room *game.Room) map[*websocket.Conn]*game.Player {
+	room.Lock()
+	defer room.Unlock()
+
+	spectators := make(map[*websocket.Conn]*game.Player, len(room.Spectators))
+	for conn, spectator := range room.Spectators {
+		spectators[conn] = spectator
+	}
+	return spectators
+}
+
+// spectatorCount returns the number of spectators watching the room.
+func spectatorCount(room *game.Room) int {
+	room.Lock()
+	defer room.Unlock()
+	return len(room.Spectators)
+}
+
+// dropSpectator removes a connection from the room's spectators and returns
+// how many are left.
+func dropSpectator(room *game.Room, conn *websocket.Conn) int {
+	room.Lock()
+	defer room.Unlock()
+	delete(room.Spectators, conn)
+	return len(room.Spectators)
+}
+
+// broadcastToSpectators sends a message to everyone watching a room.
+// Spectators whose connection fails are dropped.
+func broadcastToSpectators(room *game.Room, message interface{}) {
+	for conn, spectator := range roomSpectators(room) {
+		if err := spectator.Send(message); err != nil {
+			log.Printf("Error sending message to spectator %s: %v", spectator.Username, err)
+			conn.Close()
+			dropSpectator(room, conn)
+		}
+	}
+}
+
+// closeSpectators disconnects everyone watching a room that is being closed.
+func closeSpectators(room *game.Room, reason string) {
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	for conn := range roomSpectators(room) {
+		conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+		conn.Close()
+		dropSpectator(room, conn)
+	}
+}
+
+// spectateRoom watches a room on behalf of a spectator connection until the
+// spectator leaves or disconnects. Spectators get the current state of every
+// player when they join, including after the game has started, followed by
+// all room broadcasts and a "player_progress" event whenever a player moves
+// on to another question. They cannot take part in the game.
+func spectateRoom(conn *websocket.Conn, room *game.Room, username string) {
+	spectator := &game.Player{
+		ID:       generatePlayerID(),
+		Username: username,
+		Conn:     conn,
+	}
+
+	players := []map[string]interface{}{}
+	for _, player := range roomPlayers(room) {
+		players = append(players, playerProgress(room, player))
+	}
+
+	spectator.Send(map[string]interface{}{
+		"event": "spectating",
+		"data": map[string]interface{}{
+			"id":            spectator.ID,
+			"room":          room.Code,
+			"gamemode":      room.GameMode,
+			"started":       room.Start,
+			"num_questions": len(room.Questions),
+			"teams":         room.Teams,
+			"players":       players,
+		},
+	})
+
+	room.Lock()
+	room.Spectators[conn] = spectator
+	watching := len(room.Spectators)
+	room.Unlock()
+
+	notifyLobby()
+	broadcastToRoom(room, map[string]interface{}{
+		"event": "spectatorJoined",
+		"data": map[string]interface{}{
+			"username":   spectator.Username,
+			"id":         spectator.ID,
+			"spectators": watching,
+		},
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+
+	for message := range readMessages(conn, spectator, done) {
+		if message.Event == "leave" {
+			break
+		}
+		spectator.Send(map[string]string{"error": "Spectators cannot play"})
+	}
+
+	watching = dropSpectator(room, conn)
+	notifyLobby()
+	broadcastToRoom(room, map[string]interface{}{
+		"event": "spectatorLeft",
+		"data": map[string]interface{}{
+			"username":   spectator.Username,
+			"id":         spectator.ID,
+			"spectators": watching,
+		},
+	})
+}
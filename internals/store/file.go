@@ -0,0 +1,293 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// File is a Store that keeps JSON files in a directory:
+//
+//	rooms/<code>.json       snapshots of open rooms
+//	results.jsonl           one finished game per line
+//	profiles/<id>.json      player profiles
+//	daily/<date>/<id>.json  daily challenge runs
+//	practice/<id>.json      practice cards of a player
+//	marathon/<id>.json      marathon run checkpoints
+type File struct {
+	dir string
+
+	// mu serialises appends to the results file
+	mu sync.Mutex
+}
+
+// NewFile returns a store keeping its files in dir, which is created when
+// something is first written.
+func NewFile(dir string) *File {
+	return &File{dir: dir}
+}
+
+// writeJSONFile encodes v to dir/name, creating dir if needed. The file is
+// replaced atomically so a crash never leaves it half-written, and each
+// write goes through its own temporary file so concurrent writes of the
+// same key cannot interleave.
+func writeJSONFile(dir, name string, v interface{}) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+// readJSONFile decodes dir/name into v, reporting whether the file exists.
+func readJSONFile(dir, name string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// validKey reports whether key can be used as a file name.
+func validKey(key string) bool {
+	return key != "" && key != "." && key != ".." && !strings.ContainsAny(key, `/\`)
+}
+
+func (f *File) roomsDir() string    { return filepath.Join(f.dir, "rooms") }
+func (f *File) profilesDir() string { return filepath.Join(f.dir, "profiles") }
+func (f *File) resultsPath() string { return filepath.Join(f.dir, "results.jsonl") }
+
+func (f *File) practiceDir() string { return filepath.Join(f.dir, "practice") }
+func (f *File) marathonDir() string { return filepath.Join(f.dir, "marathon") }
+
+func (f *File) dailyDir(date string) string { return filepath.Join(f.dir, "daily", date) }
+
+func (f *File) SaveRoom(snapshot game.RoomSnapshot) error {
+	if !validKey(snapshot.Code) {
+		return ErrInvalidKey
+	}
+	return writeJSONFile(f.roomsDir(), snapshot.Code+".json", snapshot)
+}
+
+func (f *File) DeleteRoom(code string) error {
+	if !validKey(code) {
+		return ErrInvalidKey
+	}
+	err := os.Remove(filepath.Join(f.roomsDir(), code+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (f *File) Rooms() ([]game.RoomSnapshot, error) {
+	names, err := filepath.Glob(filepath.Join(f.roomsDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	snapshots := []game.RoomSnapshot{}
+	for _, name := range names {
+		var snapshot game.RoomSnapshot
+		ok, err := readJSONFile(f.roomsDir(), filepath.Base(name), &snapshot)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+func (f *File) AddResult(result game.Result) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.resultsPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(result)
+}
+
+// EachResult reads the results file one line at a time, so only a single
+// result is held in memory however many games have been recorded.
+func (f *File) EachResult(fn func(game.Result) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.Open(f.resultsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var result game.Result
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return err
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (f *File) Profile(id string) (*game.Profile, error) {
+	if !validKey(id) {
+		return nil, ErrInvalidKey
+	}
+
+	var profile game.Profile
+	ok, err := readJSONFile(f.profilesDir(), id+".json", &profile)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (f *File) SaveProfile(profile *game.Profile) error {
+	if !validKey(profile.ID) {
+		return ErrInvalidKey
+	}
+	return writeJSONFile(f.profilesDir(), profile.ID+".json", profile)
+}
+
+func (f *File) SaveDailyRun(run game.DailyRun) error {
+	if !validKey(run.Date) || !validKey(run.PlayerID) {
+		return ErrInvalidKey
+	}
+	return writeJSONFile(f.dailyDir(run.Date), run.PlayerID+".json", run)
+}
+
+func (f *File) DailyRuns(date string) ([]game.DailyRun, error) {
+	if !validKey(date) {
+		return nil, ErrInvalidKey
+	}
+
+	names, err := filepath.Glob(filepath.Join(f.dailyDir(date), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	runs := []game.DailyRun{}
+	for _, name := range names {
+		var run game.DailyRun
+		ok, err := readJSONFile(f.dailyDir(date), filepath.Base(name), &run)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+func (f *File) PracticeCards(playerID string) (map[string]*game.PracticeCard, error) {
+	if !validKey(playerID) {
+		return nil, ErrInvalidKey
+	}
+
+	var cards map[string]*game.PracticeCard
+	if _, err := readJSONFile(f.practiceDir(), playerID+".json", &cards); err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+func (f *File) SavePracticeCards(playerID string, cards map[string]*game.PracticeCard) error {
+	if !validKey(playerID) {
+		return ErrInvalidKey
+	}
+	return writeJSONFile(f.practiceDir(), playerID+".json", cards)
+}
+
+func (f *File) SaveMarathonRun(run game.MarathonRun) error {
+	if !validKey(run.ID) {
+		return ErrInvalidKey
+	}
+	return writeJSONFile(f.marathonDir(), run.ID+".json", run)
+}
+
+func (f *File) DeleteMarathonRun(id string) error {
+	if !validKey(id) {
+		return ErrInvalidKey
+	}
+	err := os.Remove(filepath.Join(f.marathonDir(), id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (f *File) MarathonRuns() ([]game.MarathonRun, error) {
+	names, err := filepath.Glob(filepath.Join(f.marathonDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	runs := []game.MarathonRun{}
+	for _, name := range names {
+		var run game.MarathonRun
+		ok, err := readJSONFile(f.marathonDir(), filepath.Base(name), &run)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
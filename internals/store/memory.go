@@ -0,0 +1,178 @@
+package store
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// Memory is a Store that keeps everything in memory. Nothing survives a
+// restart, which makes it suited to tests and throwaway servers.
+type Memory struct {
+	mu       sync.Mutex
+	rooms    map[string]game.RoomSnapshot
+	results  []game.Result
+	profiles map[string]game.Profile
+	daily    map[string]map[string]game.DailyRun
+	practice map[string]map[string]game.PracticeCard
+	marathon map[string]game.MarathonRun
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		rooms:    make(map[string]game.RoomSnapshot),
+		profiles: make(map[string]game.Profile),
+		daily:    make(map[string]map[string]game.DailyRun),
+		practice: make(map[string]map[string]game.PracticeCard),
+		marathon: make(map[string]game.MarathonRun),
+	}
+}
+
+func (m *Memory) SaveRoom(snapshot game.RoomSnapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rooms[snapshot.Code] = snapshot
+	return nil
+}
+
+func (m *Memory) DeleteRoom(code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.rooms, code)
+	return nil
+}
+
+func (m *Memory) Rooms() ([]game.RoomSnapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshots := make([]game.RoomSnapshot, 0, len(m.rooms))
+	for _, snapshot := range m.rooms {
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Code < snapshots[j].Code
+	})
+	return snapshots, nil
+}
+
+func (m *Memory) AddResult(result game.Result) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results = append(m.results, result)
+	return nil
+}
+
+func (m *Memory) EachResult(fn func(game.Result) error) error {
+	m.mu.Lock()
+	results := append([]game.Result(nil), m.results...)
+	m.mu.Unlock()
+
+	for _, result := range results {
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Profile(id string) (*game.Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	profile, ok := m.profiles[id]
+	if !ok {
+		return nil, nil
+	}
+	return &profile, nil
+}
+
+func (m *Memory) SaveProfile(profile *game.Profile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.profiles[profile.ID] = *profile
+	return nil
+}
+
+func (m *Memory) SaveDailyRun(run game.DailyRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.daily[run.Date] == nil {
+		m.daily[run.Date] = make(map[string]game.DailyRun)
+	}
+	m.daily[run.Date][run.PlayerID] = run
+	return nil
+}
+
+func (m *Memory) DailyRuns(date string) ([]game.DailyRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	runs := make([]game.DailyRun, 0, len(m.daily[date]))
+	for _, run := range m.daily[date] {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].PlayerID < runs[j].PlayerID
+	})
+	return runs, nil
+}
+
+func (m *Memory) PracticeCards(playerID string) (map[string]*game.PracticeCard, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.practice[playerID]
+	if !ok {
+		return nil, nil
+	}
+	cards := make(map[string]*game.PracticeCard, len(stored))
+	for code, card := range stored {
+		card := card
+		cards[code] = &card
+	}
+	return cards, nil
+}
+
+func (m *Memory) SavePracticeCards(playerID string, cards map[string]*game.PracticeCard) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := make(map[string]game.PracticeCard, len(cards))
+	for code, card := range cards {
+		stored[code] = *card
+	}
+	m.practice[playerID] = stored
+	return nil
+}
+
+func (m *Memory) SaveMarathonRun(run game.MarathonRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.marathon[run.ID] = run
+	return nil
+}
+
+func (m *Memory) DeleteMarathonRun(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.marathon, id)
+	return nil
+}
+
+func (m *Memory) MarathonRuns() ([]game.MarathonRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	runs := make([]game.MarathonRun, 0, len(m.marathon))
+	for _, run := range m.marathon {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].ID < runs[j].ID
+	})
+	return runs, nil
+}
@@ -0,0 +1,53 @@
+// Package store persists the data that outlives a room: snapshots of open
+// rooms, the results of finished games, player profiles with their ratings,
+// daily challenge runs, practice histories and marathon runs.
+package store
+
+import (
+	"errors"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// ErrInvalidKey is returned for room codes, profile IDs and dates that cannot be
+// stored, such as ones containing path separators.
+var ErrInvalidKey = errors.New("invalid key")
+
+// Store is implemented by every persistence backend.
+type Store interface {
+	// SaveRoom creates or replaces the snapshot of an open room.
+	SaveRoom(snapshot game.RoomSnapshot) error
+	// DeleteRoom forgets the snapshot of a room that has closed.
+	DeleteRoom(code string) error
+	// Rooms returns the snapshots of every room that has not been deleted.
+	Rooms() ([]game.RoomSnapshot, error)
+
+	// AddResult records the result of a finished game.
+	AddResult(result game.Result) error
+	// EachResult calls fn with every recorded result, oldest first, and
+	// stops at the first error fn returns.
+	EachResult(fn func(game.Result) error) error
+
+	// Profile returns a player's profile, or nil if there is none.
+	Profile(id string) (*game.Profile, error)
+	// SaveProfile creates or replaces a player's profile.
+	SaveProfile(profile *game.Profile) error
+
+	// SaveDailyRun creates or replaces a player's run of a daily challenge.
+	SaveDailyRun(run game.DailyRun) error
+	// DailyRuns returns every run of the daily challenge of date.
+	DailyRuns(date string) ([]game.DailyRun, error)
+
+	// PracticeCards returns a player's practice cards keyed by ISO2, or
+	// nil if they have not practised yet.
+	PracticeCards(playerID string) (map[string]*game.PracticeCard, error)
+	// SavePracticeCards creates or replaces a player's practice cards.
+	SavePracticeCards(playerID string, cards map[string]*game.PracticeCard) error
+
+	// SaveMarathonRun creates or replaces the checkpoint of a marathon run.
+	SaveMarathonRun(run game.MarathonRun) error
+	// DeleteMarathonRun forgets a marathon run.
+	DeleteMarathonRun(id string) error
+	// MarathonRuns returns every marathon run that has not been deleted.
+	MarathonRuns() ([]game.MarathonRun, error)
+}
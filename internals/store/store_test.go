@@ -0,0 +1,427 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// backends returns a fresh instance of every Store implementation.
+func backends(t *testing.T) map[string]Store {
+	return map[string]Store{
+		"file":   NewFile(t.TempDir()),
+		"memory": NewMemory(),
+	}
+}
+
+func TestRooms(t *testing.T) {
+	updated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	lobby := game.RoomSnapshot{
+		Code:         "1234",
+		Host:         "ana",
+		GameMode:     game.GameTypeMCQ,
+		NumQuestions: 10,
+		TimeLimit:    5,
+		Public:       true,
+		Players:      []game.Standing{{PlayerID: "p1", Username: "ana"}},
+		UpdatedAt:    updated,
+	}
+	started := game.RoomSnapshot{
+		Code:              "5678",
+		Host:              "ben",
+		GameMode:          game.GameTypeSurvival,
+		Region:            "europe",
+		NumQuestions:      20,
+		TimeLimit:         10,
+		QuestionTimeLimit: 15,
+		Teams:             2,
+		Started:           true,
+		Players: []game.Standing{
+			{PlayerID: "p2", Username: "ben", Score: 7, Team: 1, ProfileID: "g2"},
+			{PlayerID: "p3", Username: "cy", Score: 3, Team: 2, Eliminated: true},
+		},
+		UpdatedAt: updated,
+	}
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			rooms, err := s.Rooms()
+			if err != nil || len(rooms) != 0 {
+				t.Fatalf("Rooms() on an empty store = %v, %v", rooms, err)
+			}
+
+			for _, snapshot := range []game.RoomSnapshot{started, lobby} {
+				if err := s.SaveRoom(snapshot); err != nil {
+					t.Fatalf("SaveRoom(%s): %v", snapshot.Code, err)
+				}
+			}
+
+			// Saving again replaces the snapshot
+			lobby.Players = append(lobby.Players, game.Standing{PlayerID: "p4", Username: "dee"})
+			if err := s.SaveRoom(lobby); err != nil {
+				t.Fatalf("SaveRoom(%s): %v", lobby.Code, err)
+			}
+
+			rooms, err = s.Rooms()
+			if err != nil {
+				t.Fatalf("Rooms(): %v", err)
+			}
+			if want := []game.RoomSnapshot{lobby, started}; !reflect.DeepEqual(rooms, want) {
+				t.Errorf("Rooms() = %+v, want %+v", rooms, want)
+			}
+
+			if err := s.DeleteRoom(lobby.Code); err != nil {
+				t.Fatalf("DeleteRoom(%s): %v", lobby.Code, err)
+			}
+			if err := s.DeleteRoom("9999"); err != nil {
+				t.Errorf("DeleteRoom of a missing room: %v", err)
+			}
+
+			rooms, err = s.Rooms()
+			if err != nil {
+				t.Fatalf("Rooms(): %v", err)
+			}
+			if want := []game.RoomSnapshot{started}; !reflect.DeepEqual(rooms, want) {
+				t.Errorf("Rooms() after delete = %+v, want %+v", rooms, want)
+			}
+		})
+	}
+}
+
+func TestResults(t *testing.T) {
+	results := []game.Result{
+		{
+			RoomCode:     "1234",
+			GameMode:     game.GameTypeMCQ,
+			NumQuestions: 10,
+			Standings: []game.Standing{
+				{
+					Rank: 1, PlayerID: "p1", Username: "ana", Score: 9, BestStreak: 5, Completed: true,
+					ProfileID: "g1", Rating: &game.RatingChange{Before: 1200, After: 1210},
+				},
+				{
+					Rank: 2, PlayerID: "p2", Username: "ben", Score: 4, Completed: true,
+					ProfileID: "g2", Rating: &game.RatingChange{Before: 1200, After: 1190},
+				},
+			},
+			Reason:  "completed",
+			EndedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			RoomCode:     "5678",
+			GameMode:     game.GameTypeSurvival,
+			Region:       "europe",
+			NumQuestions: 20,
+			Standings:    []game.Standing{{Rank: 1, PlayerID: "p3", Username: "cy", Team: 1}},
+			Teams:        []game.TeamStanding{{Team: 1, Score: 0, Rank: 1}},
+			Winner:       "cy",
+			Reason:       "interrupted",
+			EndedAt:      time.Date(2024, 5, 2, 8, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			var got []game.Result
+			collect := func(result game.Result) error {
+				got = append(got, result)
+				return nil
+			}
+
+			if err := s.EachResult(collect); err != nil || len(got) != 0 {
+				t.Fatalf("EachResult() on an empty store = %v, %v", got, err)
+			}
+
+			for _, result := range results {
+				if err := s.AddResult(result); err != nil {
+					t.Fatalf("AddResult(%s): %v", result.RoomCode, err)
+				}
+			}
+
+			if err := s.EachResult(collect); err != nil {
+				t.Fatalf("EachResult(): %v", err)
+			}
+			if !reflect.DeepEqual(got, results) {
+				t.Errorf("EachResult() = %+v, want %+v", got, results)
+			}
+
+			// An error from the callback stops the iteration
+			stop := errors.New("stop")
+			calls := 0
+			err := s.EachResult(func(game.Result) error {
+				calls++
+				return stop
+			})
+			if err != stop || calls != 1 {
+				t.Errorf("EachResult() with a failing callback = %v after %d calls, want %v after 1", err, calls, stop)
+			}
+		})
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	profile := &game.Profile{
+		ID:        "g1",
+		Username:  "ana",
+		Rating:    1234,
+		Games:     12,
+		Wins:      5,
+		UpdatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			got, err := s.Profile(profile.ID)
+			if err != nil || got != nil {
+				t.Fatalf("Profile() of a new player = %v, %v, want nil", got, err)
+			}
+
+			if err := s.SaveProfile(profile); err != nil {
+				t.Fatalf("SaveProfile(): %v", err)
+			}
+			got, err = s.Profile(profile.ID)
+			if err != nil {
+				t.Fatalf("Profile(): %v", err)
+			}
+			if !reflect.DeepEqual(got, profile) {
+				t.Errorf("Profile() = %+v, want %+v", got, profile)
+			}
+
+			// The stored profile does not change with the caller's copy
+			profile.Rating = 1300
+			got, _ = s.Profile(profile.ID)
+			if got.Rating != 1234 {
+				t.Errorf("stored rating changed to %d with the caller's copy", got.Rating)
+			}
+			profile.Rating = 1234
+		})
+	}
+}
+
+func TestDailyRuns(t *testing.T) {
+	started := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	completed := started.Add(95 * time.Second)
+	runs := []game.DailyRun{
+		{PlayerID: "g1", Username: "ana", Date: "2024-05-01", Results: []bool{true, false, true}, StartedAt: started, CompletedAt: &completed},
+		{PlayerID: "g2", Username: "ben", Date: "2024-05-01", Results: []bool{false}, StartedAt: started},
+		{PlayerID: "g1", Username: "ana", Date: "2024-05-02", Results: []bool{}, StartedAt: started.Add(24 * time.Hour)},
+	}
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, run := range runs {
+				if err := s.SaveDailyRun(run); err != nil {
+					t.Fatalf("SaveDailyRun(%s, %s): %v", run.Date, run.PlayerID, err)
+				}
+			}
+
+			// Saving again replaces the player's run of that day
+			runs[1].Results = append(runs[1].Results, true)
+			if err := s.SaveDailyRun(runs[1]); err != nil {
+				t.Fatalf("SaveDailyRun(): %v", err)
+			}
+
+			got, err := s.DailyRuns("2024-05-01")
+			if err != nil {
+				t.Fatalf("DailyRuns(): %v", err)
+			}
+			if want := runs[:2]; !reflect.DeepEqual(got, want) {
+				t.Errorf("DailyRuns(2024-05-01) = %+v, want %+v", got, want)
+			}
+
+			got, err = s.DailyRuns("2024-05-03")
+			if err != nil || len(got) != 0 {
+				t.Errorf("DailyRuns() of a day without runs = %v, %v", got, err)
+			}
+			runs[1].Results = runs[1].Results[:1]
+		})
+	}
+}
+
+func TestPracticeCards(t *testing.T) {
+	due := time.Date(2024, 5, 3, 9, 0, 0, 0, time.UTC)
+	cards := map[string]*game.PracticeCard{
+		"fr": {Country: "fr", Attempts: 3, Correct: 2, Repetitions: 1, Ease: 2.5, IntervalDays: 1, Due: due, LastReviewed: due.Add(-24 * time.Hour)},
+		"jp": {Country: "jp", Attempts: 1, Ease: 2.3, Due: due},
+	}
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			got, err := s.PracticeCards("g1")
+			if err != nil || got != nil {
+				t.Fatalf("PracticeCards() of a new player = %v, %v, want nil", got, err)
+			}
+
+			if err := s.SavePracticeCards("g1", cards); err != nil {
+				t.Fatalf("SavePracticeCards(): %v", err)
+			}
+			got, err = s.PracticeCards("g1")
+			if err != nil {
+				t.Fatalf("PracticeCards(): %v", err)
+			}
+			if !reflect.DeepEqual(got, cards) {
+				t.Errorf("PracticeCards() = %+v, want %+v", got, cards)
+			}
+
+			// The stored cards do not change with the caller's copy
+			got["fr"].Attempts = 10
+			got, _ = s.PracticeCards("g1")
+			if got["fr"].Attempts != 3 {
+				t.Errorf("stored attempts changed to %d with the caller's copy", got["fr"].Attempts)
+			}
+		})
+	}
+}
+
+func TestMarathonRuns(t *testing.T) {
+	started := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	runs := []game.MarathonRun{
+		{
+			ID:        "0123456789abcdef0123456789abcdef",
+			PlayerID:  "g1",
+			Questions: []game.Question{{FlagURL: "/static/flags/fr.svg", Options: []string{"France", "Italy"}, Answer: "France"}},
+			Index:     1,
+			Missed:    []game.MissedFlag{{FlagURL: "/static/flags/fr.svg", Country: "France", ChosenAnswer: "Italy"}},
+			StartedAt: started,
+			UpdatedAt: started.Add(time.Minute),
+		},
+		{
+			ID:        "fedcba9876543210fedcba9876543210",
+			Region:    "europe",
+			Questions: []game.Question{},
+			Missed:    []game.MissedFlag{},
+			StartedAt: started,
+			UpdatedAt: started,
+		},
+	}
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			got, err := s.MarathonRuns()
+			if err != nil || len(got) != 0 {
+				t.Fatalf("MarathonRuns() on an empty store = %v, %v", got, err)
+			}
+
+			for _, run := range []game.MarathonRun{runs[1], runs[0]} {
+				if err := s.SaveMarathonRun(run); err != nil {
+					t.Fatalf("SaveMarathonRun(%s): %v", run.ID, err)
+				}
+			}
+
+			got, err = s.MarathonRuns()
+			if err != nil {
+				t.Fatalf("MarathonRuns(): %v", err)
+			}
+			if !reflect.DeepEqual(got, runs) {
+				t.Errorf("MarathonRuns() = %+v, want %+v", got, runs)
+			}
+
+			if err := s.DeleteMarathonRun(runs[0].ID); err != nil {
+				t.Fatalf("DeleteMarathonRun(): %v", err)
+			}
+			if err := s.DeleteMarathonRun(runs[0].ID); err != nil {
+				t.Errorf("DeleteMarathonRun of a missing run: %v", err)
+			}
+
+			got, err = s.MarathonRuns()
+			if err != nil {
+				t.Fatalf("MarathonRuns(): %v", err)
+			}
+			if want := runs[1:]; !reflect.DeepEqual(got, want) {
+				t.Errorf("MarathonRuns() after delete = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestFileInvalidKeys(t *testing.T) {
+	s := NewFile(t.TempDir())
+
+	for _, key := range []string{"", "..", "../rooms", "a/b", `a\b`} {
+		if err := s.SaveRoom(game.RoomSnapshot{Code: key}); err != ErrInvalidKey {
+			t.Errorf("SaveRoom(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := s.Profile(key); err != ErrInvalidKey {
+			t.Errorf("Profile(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := s.DailyRuns(key); err != ErrInvalidKey {
+			t.Errorf("DailyRuns(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := s.PracticeCards(key); err != ErrInvalidKey {
+			t.Errorf("PracticeCards(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if err := s.SaveMarathonRun(game.MarathonRun{ID: key}); err != ErrInvalidKey {
+			t.Errorf("SaveMarathonRun(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestFileSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	result := game.Result{RoomCode: "1234", GameMode: game.GameTypeMCQ, Reason: "completed", EndedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	snapshot := game.RoomSnapshot{Code: "5678", Started: true, UpdatedAt: result.EndedAt}
+
+	s := NewFile(dir)
+	if err := s.AddResult(result); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveRoom(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewFile(dir)
+	var results []game.Result
+	if err := reopened.EachResult(func(r game.Result) error {
+		results = append(results, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []game.Result{result}; !reflect.DeepEqual(results, want) {
+		t.Errorf("results after reopening = %+v, want %+v", results, want)
+	}
+
+	rooms, err := reopened.Rooms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []game.RoomSnapshot{snapshot}; !reflect.DeepEqual(rooms, want) {
+		t.Errorf("rooms after reopening = %+v, want %+v", rooms, want)
+	}
+}
+
+func TestFileConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFile(dir)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			snapshot := game.RoomSnapshot{Code: "1234", NumQuestions: i, Players: make([]game.Standing, i)}
+			if err := s.SaveRoom(snapshot); err != nil {
+				t.Errorf("SaveRoom(): %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// One of the writes wins whole and no temporary files are left behind
+	rooms, err := s.Rooms()
+	if err != nil {
+		t.Fatalf("Rooms(): %v", err)
+	}
+	if len(rooms) != 1 || len(rooms[0].Players) != rooms[0].NumQuestions {
+		t.Errorf("Rooms() after concurrent writes = %+v", rooms)
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "rooms", "*"))
+	if err != nil || len(names) != 1 {
+		t.Errorf("files after concurrent writes = %v, %v, want only the snapshot", names, err)
+	}
+}
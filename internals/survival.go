@@ -0,0 +1,86 @@
+package internals
+
+import (
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// survivingPlayers returns the players of a room who have not been eliminated.
+func survivingPlayers(room *game.Room) []*game.Player {
+	var survivors []*game.Player
+	for _, player := range roomPlayers(room) {
+		if player != nil && !player.Eliminated {
+			survivors = append(survivors, player)
+		}
+	}
+	return survivors
+}
+
+// eliminatePlayer knocks a player out of a survival game. The player stays
+// connected as a spectator and keeps receiving the room's broadcasts.
+func eliminatePlayer(room *game.Room, player *game.Player) {
+	player.Eliminated = true
+	player.Completed = true
+
+	survivors := survivingPlayers(room)
+
+	broadcastToRoom(room, map[string]interface{}{
+		"event": "player_eliminated",
+		"data": map[string]interface{}{
+			"id":        player.ID,
+			"username":  player.Username,
+			"score":     player.Score,
+			"remaining": len(survivors),
+		},
+	})
+
+	checkSurvivalWinner(room)
+}
+
+// checkSurvivalWinner declares the last player standing the winner of a
+// survival game. Solo games have no winner to declare; the run simply ends
+// when the player is eliminated or answers every question.
+func checkSurvivalWinner(room *game.Room) {
+	if room.GameMode != game.GameTypeSurvival || !room.Start || room.Winner != "" || room.Contestants < 2 {
+		return
+	}
+
+	survivors := survivingPlayers(room)
+	if len(survivors) != 1 {
+		return
+	}
+
+	declareWinner(room, survivors[0])
+}
+
+// declareSurvivalWinnerByScore is used when several players survive every
+// question; the highest score among the survivors wins.
+func declareSurvivalWinnerByScore(room *game.Room) {
+	if room.GameMode != game.GameTypeSurvival || room.Winner != "" || room.Contestants < 2 {
+		return
+	}
+
+	var winner *game.Player
+	for _, player := range survivingPlayers(room) {
+		if winner == nil || player.Score > winner.Score {
+			winner = player
+		}
+	}
+
+	if winner != nil {
+		declareWinner(room, winner)
+	}
+}
+
+func declareWinner(room *game.Room, winner *game.Player) {
+	room.Winner = winner.Username
+	winner.Completed = true
+
+	broadcastToRoom(room, map[string]interface{}{
+		"event": "winner",
+		"data": map[string]interface{}{
+			"id":       winner.ID,
+			"username": winner.Username,
+			"score":    winner.Score,
+		},
+	})
+}
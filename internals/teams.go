@@ -0,0 +1,117 @@
+package internals
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+// Team counts accepted for rooms with teams.
+const (
+	minTeams = 2
+	maxTeams = 4
+)
+
+var teamNames = []string{"Red", "Blue", "Green", "Yellow"}
+
+func teamName(team int) string {
+	if team < 1 || team > len(teamNames) {
+		return "Team " + strconv.Itoa(team)
+	}
+	return teamNames[team-1]
+}
+
+// teamSizes returns the number of players in each team, indexed by team
+// number minus one. except is left out of the count.
+func teamSizes(room *game.Room, except *game.Player) []int {
+	sizes := make([]int, room.Teams)
+	for _, player := range roomPlayers(room) {
+		if player != nil && player != except && player.Team > 0 && player.Team <= room.Teams {
+			sizes[player.Team-1]++
+		}
+	}
+	return sizes
+}
+
+// assignTeam places a player in a team of the room. A requested team of 0
+// auto-balances the player into the smallest team. Picking a team is
+// refused when it would leave it two players ahead of the smallest one.
+func assignTeam(room *game.Room, player *game.Player, requested int) (int, error) {
+	sizes := teamSizes(room, player)
+
+	smallest := 0
+	for i, size := range sizes {
+		if size < sizes[smallest] {
+			smallest = i
+		}
+	}
+
+	if requested == 0 {
+		return smallest + 1, nil
+	}
+
+	if requested < 1 || requested > room.Teams {
+		return 0, fmt.Errorf("team must be between 1 and %d", room.Teams)
+	}
+
+	if sizes[requested-1] > sizes[smallest] {
+		return 0, fmt.Errorf("team %s is full, pick another team", teamName(requested))
+	}
+
+	return requested, nil
+}
+
+// teamStandings ranks the teams of a room by the sum of their members'
+// scores. Rooms without teams have no standings.
+func teamStandings(room *game.Room) []game.TeamStanding {
+	if room.Teams == 0 {
+		return nil
+	}
+
+	standings := make([]game.TeamStanding, room.Teams)
+	for i := range standings {
+		standings[i] = game.TeamStanding{Team: i + 1, Name: teamName(i + 1), Members: []string{}}
+	}
+
+	for _, player := range roomPlayers(room) {
+		if player == nil || player.Team < 1 || player.Team > room.Teams {
+			continue
+		}
+		standing := &standings[player.Team-1]
+		standing.Score += player.Score
+		standing.Members = append(standing.Members, player.Username)
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		return standings[i].Score > standings[j].Score
+	})
+
+	for i := range standings {
+		sort.Strings(standings[i].Members)
+		standings[i].Rank = i + 1
+	}
+
+	return standings
+}
+
+// scoreEvent is the "score" event broadcast when a player scores, carrying
+// the team standings in rooms with teams.
+func scoreEvent(room *game.Room, player *game.Player) map[string]interface{} {
+	data := map[string]interface{}{
+		"username": player.Username,
+		"score":    player.Score,
+		"streak":   player.Streak,
+	}
+
+	if room.Teams > 0 {
+		data["team"] = player.Team
+		data["teams"] = teamStandings(room)
+	}
+
+	return map[string]interface{}{
+		"event": "score",
+		"data":  data,
+	}
+}
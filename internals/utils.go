@@ -1,38 +1,108 @@
 package internals
 
 import (
-	"encoding/csv"
+	"context"
 	"log"
 	"math/rand"
-	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/adimail/fun-with-flags/internals/game"
+	"github.com/gorilla/websocket"
 )
 
+// mu guards rooms.
 var mu sync.Mutex
 
-func StartRoomCleanup(interval time.Duration) {
+// lookupRoom returns the room registered under code.
+func lookupRoom(code string) (*game.Room, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	room, ok := rooms[code]
+	return room, ok
+}
+
+// unregisterRoom removes room from the registry. A room whose code has
+// since been given to another room is left alone. It reports whether the
+// room was removed.
+func unregisterRoom(room *game.Room) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if rooms[room.Code] != room {
+		return false
+	}
+	delete(rooms, room.Code)
+	return true
+}
+
+// StartRoomCleanup periodically deletes empty rooms until ctx is cancelled.
+func StartRoomCleanup(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		cleanupEmptyRooms()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cleanupEmptyRooms()
+		}
+	}
+}
+
+// roomPlayers returns a copy of the room's players, so callers can range
+// over them without holding the room lock while writing to connections.
+func roomPlayers(room *game.Room) map[*websocket.Conn]*game.Player {
+	room.Lock()
+	defer room.Unlock()
+
+	players := make(map[*websocket.Conn]*game.Player, len(room.Players))
+	for conn, player := range room.Players {
+		players[conn] = player
+	}
+	return players
+}
+
+// playerCount returns the number of players in the room.
+func playerCount(room *game.Room) int {
+	room.Lock()
+	defer room.Unlock()
+	return len(room.Players)
+}
+
+// dropPlayer removes a connection from the room's players and returns how
+// many are left.
+func dropPlayer(room *game.Room, conn *websocket.Conn) int {
+	room.Lock()
+	defer room.Unlock()
+	delete(room.Players, conn)
+	return len(room.Players)
+}
+
+// stopGameTimer stops the timer of a room that closes before its time
+// limit is up.
+func stopGameTimer(room *game.Room) {
+	room.Lock()
+	defer room.Unlock()
+	if room.GameTimer != nil {
+		room.GameTimer.Stop()
 	}
 }
 
 func cleanupEmptyRooms() {
 	mu.Lock()
-	defer mu.Unlock()
-
 	for roomID, room := range rooms {
-		if len(room.Players) == 0 {
+		if playerCount(room) == 0 {
 			log.Printf("Deleting empty room: %s", roomID)
+			closeSpectators(room, "room_closed")
+			stopGameTimer(room)
 			delete(rooms, roomID)
+			forgetRoom(roomID)
 		}
 	}
+	mu.Unlock()
+
+	notifyLobby()
 }
 
 func newRandomGenerator() *rand.Rand {
@@ -45,53 +115,63 @@ func shuffleOptions(options []string, rng *rand.Rand) {
 	})
 }
 
-func shuffleCountries(rows [][]string, rng *rand.Rand) {
-	rng.Shuffle(len(rows), func(i, j int) {
-		rows[i], rows[j] = rows[j], rows[i]
+func shuffleCountries(countries []game.Country, rng *rand.Rand) {
+	rng.Shuffle(len(countries), func(i, j int) {
+		countries[i], countries[j] = countries[j], countries[i]
 	})
 }
 
-func selectRandomCountries(rows [][]string, count int, rng *rand.Rand) [][]string {
-	rng.Shuffle(len(rows), func(i, j int) {
-		rows[i], rows[j] = rows[j], rows[i]
-	})
-	if len(rows) < count {
-		return rows
+func selectRandomCountries(countries []game.Country, count int, rng *rand.Rand) []game.Country {
+	shuffleCountries(countries, rng)
+	if len(countries) < count {
+		return countries
 	}
-	return rows[:count]
+	return countries[:count]
 }
 
 func generateQuestions(numQuestions int, gameType string) ([]game.Question, error) {
-	file, err := os.Open("./data/countries.csv")
+	c, err := getCatalog()
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	rows, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
+	rng := newRandomGenerator()
+
+	switch gameType {
+	case game.GameTypeCapital, game.GameTypeCapitalToFlag:
+		return generateCapitalQuestions(c, numQuestions, gameType, rng), nil
+	case game.GameTypeHigherLowerPopulation, game.GameTypeHigherLowerArea:
+		return generateHigherLowerQuestions(c, numQuestions, gameType, rng)
+	case game.GameTypeSpotReal:
+		return generateSpotRealQuestions(c, numQuestions, rng)
+	case game.GameTypeColors:
+		return generateColorQuestions(c, numQuestions, rng), nil
+	case game.GameTypeNeighbourChain:
+		return generateChainQuestions(c, rng), nil
 	}
 
-	rng := newRandomGenerator()
-	selectedCountries := selectRandomCountries(rows, numQuestions, rng)
+	if game.UsesWholeCatalog(gameType) {
+		numQuestions = len(c.countries)
+	}
 
-	var questions []game.Question
-	for i, row := range selectedCountries {
-		countryName := row[0]
-		countryCode := row[1]
-		flagURL := filepath.Join("/static/svg", countryCode+".svg")
+	selectedCountries := selectRandomCountries(c.filter(""), numQuestions, rng)
 
+	var questions []game.Question
+	for i, country := range selectedCountries {
 		question := game.Question{
-			FlagURL: flagURL,
-			Answer:  countryName,
+			FlagURL: country.FlagURL(),
+			Answer:  country.Name,
 		}
 
-		if gameType != "MAP" {
-			options := []string{countryName}
+		if gameType == game.GameTypeZoom {
+			question.Country = country.ISO2
+			question.Seed = newQuestionSeed(rng)
+		}
+
+		if game.HasOptions(gameType) {
+			options := []string{country.Name}
 			for j := 0; j < 3; j++ {
-				options = append(options, selectedCountries[(i+j+1)%len(selectedCountries)][0])
+				options = append(options, selectedCountries[(i+j+1)%len(selectedCountries)].Name)
 			}
 			shuffleOptions(options, rng)
 			question.Options = options
@@ -104,13 +184,18 @@ func generateQuestions(numQuestions int, gameType string) ([]game.Question, erro
 
 func getSerializablePlayers(room *game.Room) []map[string]interface{} {
 	players := []map[string]interface{}{}
-	for _, playerConn := range room.Players {
+	for _, playerConn := range roomPlayers(room) {
 		if playerConn != nil {
-			players = append(players, map[string]interface{}{
-				"id":       playerConn.ID,
-				"username": playerConn.Username,
-				"score":    playerConn.Score,
-			})
+			player := map[string]interface{}{
+				"id":         playerConn.ID,
+				"username":   playerConn.Username,
+				"score":      playerConn.Score,
+				"bestStreak": playerConn.BestStreak,
+			}
+			if room.Teams > 0 {
+				player["team"] = playerConn.Team
+			}
+			players = append(players, player)
 		}
 	}
 	return players
@@ -121,7 +206,7 @@ func calculateScore(answers int, totalquestions int, submissiontime int, totalti
 }
 
 func allPlayersCompleted(room *game.Room) bool {
-	for _, player := range room.Players {
+	for _, player := range roomPlayers(room) {
 		if !player.Completed {
 			return false
 		}
@@ -0,0 +1,359 @@
+package internals
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+)
+
+var (
+	iso2Pattern    = regexp.MustCompile(`^[A-Z]{2}$`)
+	iso3Pattern    = regexp.MustCompile(`^[A-Z]{3}$`)
+	numericPattern = regexp.MustCompile(`^[0-9]{3}$`)
+	flagSVGPattern = regexp.MustCompile(`^[A-Z]{2}\.svg$`)
+)
+
+// dataIssue is a single problem found while validating the dataset.
+type dataIssue struct {
+	Severity string // "error" or "warning"
+	Source   string // the file or dataset the issue was found in
+	Message  string
+}
+
+// dataReport collects the issues found by ValidateData.
+type dataReport struct {
+	issues []dataIssue
+}
+
+func (r *dataReport) errorf(source, format string, args ...interface{}) {
+	r.issues = append(r.issues, dataIssue{"error", source, fmt.Sprintf(format, args...)})
+}
+
+func (r *dataReport) warnf(source, format string, args ...interface{}) {
+	r.issues = append(r.issues, dataIssue{"warning", source, fmt.Sprintf(format, args...)})
+}
+
+func (r *dataReport) count(severity string) int {
+	n := 0
+	for _, issue := range r.issues {
+		if issue.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// ValidateData cross-checks countries.json, the flag SVGs and the world
+// GeoJSON, writes a report to w and returns the number of errors found.
+//
+// Errors are problems that break a game mode: malformed rows, missing,
+// empty or unparsable flags, badly named flag files and countries that
+// cannot be found on the map. Warnings are assets that exist but are not
+// used by any question.
+func ValidateData(w io.Writer) (int, error) {
+	report := &dataReport{}
+
+	countries, err := validateCatalog(report)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := validateFlags(report, countries); err != nil {
+		return 0, err
+	}
+
+	if err := validateGeoJSON(report, countries); err != nil {
+		return 0, err
+	}
+
+	sort.Slice(report.issues, func(i, j int) bool {
+		if report.issues[i].Severity != report.issues[j].Severity {
+			return report.issues[i].Severity == "error"
+		}
+		if report.issues[i].Source != report.issues[j].Source {
+			return report.issues[i].Source < report.issues[j].Source
+		}
+		return report.issues[i].Message < report.issues[j].Message
+	})
+
+	for _, issue := range report.issues {
+		fmt.Fprintf(w, "%-7s %s: %s\n", strings.ToUpper(issue.Severity), issue.Source, issue.Message)
+	}
+
+	errorsFound := report.count("error")
+	fmt.Fprintf(w, "\n%d countries checked: %d errors, %d warnings\n", len(countries), errorsFound, report.count("warning"))
+
+	return errorsFound, nil
+}
+
+// validateCatalog checks every entry of countries.json and returns the
+// valid entries keyed by ISO2 code.
+func validateCatalog(report *dataReport) (map[string]*game.Country, error) {
+	const source = "data/countries.json"
+
+	c, err := loadCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	countries := make(map[string]*game.Country)
+	names := make(map[string]string)
+	iso3s := make(map[string]string)
+	numerics := make(map[string]string)
+
+	for i := range c.countries {
+		country := &c.countries[i]
+		entry := fmt.Sprintf("entry %d", i+1)
+
+		if strings.TrimSpace(country.Name) == "" {
+			report.errorf(source, "%s: empty country name", entry)
+			continue
+		}
+		entry = fmt.Sprintf("%s (%s)", entry, country.Name)
+
+		if !iso2Pattern.MatchString(country.ISO2) {
+			report.errorf(source, "%s: %q is not an uppercase ISO 3166-1 alpha-2 code", entry, country.ISO2)
+			continue
+		}
+
+		if !iso3Pattern.MatchString(country.ISO3) {
+			report.errorf(source, "%s: %q is not an uppercase ISO 3166-1 alpha-3 code", entry, country.ISO3)
+		}
+
+		if !numericPattern.MatchString(country.Numeric) {
+			report.errorf(source, "%s: %q is not a three digit ISO 3166-1 numeric code", entry, country.Numeric)
+		}
+
+		if country.Lat < -90 || country.Lat > 90 || country.Lon < -180 || country.Lon > 180 {
+			report.errorf(source, "%s: invalid coordinates %g,%g", entry, country.Lat, country.Lon)
+		}
+
+		if country.Continent == "" {
+			report.errorf(source, "%s: missing continent", entry)
+		}
+
+		if country.Population < 0 || country.Area <= 0 {
+			report.errorf(source, "%s: invalid population %d or area %g", entry, country.Population, country.Area)
+		}
+
+		if other, ok := countries[country.ISO2]; ok {
+			report.errorf(source, "%s: duplicate code %s (also used by %s)", entry, country.ISO2, other.Name)
+			continue
+		}
+
+		if other, ok := names[strings.ToLower(country.Name)]; ok {
+			report.errorf(source, "%s: duplicate name (also used by %s)", entry, other)
+			continue
+		}
+
+		if other, ok := iso3s[country.ISO3]; ok {
+			report.errorf(source, "%s: duplicate code %s (also used by %s)", entry, country.ISO3, other)
+		}
+
+		if other, ok := numerics[country.Numeric]; ok {
+			report.errorf(source, "%s: duplicate numeric code %s (also used by %s)", entry, country.Numeric, other)
+		}
+
+		countries[country.ISO2] = country
+		names[strings.ToLower(country.Name)] = country.ISO2
+		iso3s[country.ISO3] = country.ISO2
+		numerics[country.Numeric] = country.ISO2
+	}
+
+	for _, code := range sortedKeys(countries) {
+		country := countries[code]
+		for _, neighbour := range country.Neighbours {
+			if !iso2Pattern.MatchString(neighbour) {
+				report.errorf(source, "%s lists %q as a neighbour, which is not an ISO2 code", country.Name, neighbour)
+				continue
+			}
+
+			other, ok := countries[neighbour]
+			if !ok {
+				report.warnf(source, "%s lists %s as a neighbour, which is not in the catalog", country.Name, neighbour)
+				continue
+			}
+
+			if !containsString(other.Neighbours, code) {
+				report.errorf(source, "%s lists %s as a neighbour but not the other way round", country.Name, other.Name)
+			}
+		}
+	}
+
+	return countries, nil
+}
+
+// validateFlags checks that every country has a well-formed flag and that
+// every flag file is named after an ISO2 code.
+func validateFlags(report *dataReport, countries map[string]*game.Country) error {
+	const dir = "frontend/static/svg"
+
+	entries, err := fs.ReadDir(assets, dir)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		source := path.Join(dir, name)
+
+		if !flagSVGPattern.MatchString(name) {
+			report.errorf(source, "flag file name is not an uppercase ISO2 code")
+			continue
+		}
+
+		code := strings.TrimSuffix(name, ".svg")
+		present[code] = true
+
+		data, err := readAsset(source)
+		if err != nil {
+			return err
+		}
+
+		if len(bytes.TrimSpace(data)) == 0 {
+			report.errorf(source, "flag file is empty")
+			continue
+		}
+
+		if err := checkSVG(data); err != nil {
+			report.errorf(source, "invalid SVG: %v", err)
+			continue
+		}
+
+		if _, ok := countries[code]; !ok {
+			report.warnf(source, "flag is not used by any country in data/countries.json")
+		}
+	}
+
+	for _, code := range sortedKeys(countries) {
+		if !present[code] {
+			report.errorf("data/countries.json", "%s (%s) has no flag at %s/%s.svg", countries[code].Name, code, dir, code)
+		}
+	}
+
+	return nil
+}
+
+// checkSVG verifies that data is well-formed XML with an <svg> root element.
+func checkSVG(data []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+
+	root := ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if start, ok := token.(xml.StartElement); ok && root == "" {
+			root = start.Name.Local
+		}
+	}
+
+	if root != "svg" {
+		return fmt.Errorf("root element is %q, want \"svg\"", root)
+	}
+	return nil
+}
+
+// validateGeoJSON checks the map features' codes and that every country
+// can be located on the map. Countries are matched to features by ISO3
+// code, and the names must agree since the map game compares answers by
+// name.
+func validateGeoJSON(report *dataReport, countries map[string]*game.Country) error {
+	const source = "frontend/static/countries.geo.json"
+
+	data, err := readAsset(source)
+	if err != nil {
+		return err
+	}
+
+	var world geoFeatureCollection
+	if err := json.Unmarshal(data, &world); err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+
+	features := make(map[string]string)
+	for _, feature := range world.Features {
+		name, _ := feature.Properties["name"].(string)
+		if name == "" {
+			report.errorf(source, "feature %q has no name", feature.ID)
+			continue
+		}
+
+		// The map marks areas without an ISO code of their own, such as
+		// disputed territories, with -99; they are drawn but never asked
+		if feature.ID == "-99" {
+			report.warnf(source, "%s has no ISO 3166-1 code and cannot be played", name)
+			continue
+		}
+		if !iso3Pattern.MatchString(feature.ID) {
+			report.errorf(source, "%s has id %q which is not an ISO 3166-1 alpha-3 code", name, feature.ID)
+			continue
+		}
+
+		if _, ok := features[feature.ID]; ok {
+			report.errorf(source, "duplicate feature id %s", feature.ID)
+		}
+		features[feature.ID] = name
+	}
+
+	catalogued := make(map[string]bool)
+	for _, code := range sortedKeys(countries) {
+		country := countries[code]
+		catalogued[country.ISO3] = true
+
+		name, ok := features[country.ISO3]
+		if !ok {
+			report.errorf(source, "%s (%s) from data/countries.json has no map feature", country.Name, country.ISO3)
+			continue
+		}
+
+		if name != country.Name {
+			report.errorf(source, "%s is named %q on the map but %q in data/countries.json", country.ISO3, name, country.Name)
+		}
+	}
+
+	for id, name := range features {
+		if !catalogued[id] {
+			report.warnf(source, "%s (%s) is on the map but not in data/countries.json", name, id)
+		}
+	}
+
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -26,11 +26,33 @@ var upgrader = websocket.Upgrader{
 //   - Username: The display name of the connecting player
 //   - RoomID: The unique identifier of the game room to join
 //
+// In rooms with teams the initial message may also name the team to join;
+// players who do not pick one are balanced into the smallest team.
+//
+// Players are identified by their guest identity cookie, or by the token
+// of the initial message for clients without one. Their profile's rating is
+// updated from their final placement and the changes are included in the
+// "all_players_finished" or "time_over" event.
+//
+// Rooms created with a password also need the password in the initial
+// message, for players and spectators alike, or the joinToken returned by
+// /api/joinroom so that the password is only checked once.
+//
+// Setting spectate in the initial message joins the room as a spectator
+// instead, see spectateRoom. Spectators do not count toward the player limit
+// and can join a game that has already started.
+//
 // It enforces a maximum of 9 players per room and manages the following events:
 //   - "leave": Handle explicit player departure
 //   - "loadgame": Initialize game countdown and start
 //   - "get_new_question": Send a new question to the requesting player
-//   - "validate_answer": Validate a submitted answer and send the response to the player, broadcasting score updates if correct
+//   - "reveal_more": Show more of the flag of the current zoom question
+//   - "pick_team": Move to another team before the game starts
+//   - "chain_answer": Extend the player's neighbour chain with a country bordering the last one
+//   - "validate_answer": Validate a submitted answer and send the response to the player, broadcasting score updates if correct.
+//     In streak modes a wrong answer ends the player's run. In survival games it also
+//     eliminates the player, who stays connected as a spectator, and the last player
+//     standing is announced with a "winner" event.
 //
 // Parameters:
 //   - w: The HTTP response writer
@@ -38,7 +60,7 @@ var upgrader = websocket.Upgrader{
 //
 // The connection is automatically closed when the function returns.
 func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := upgrader.Upgrade(w, r, upgradeHeader(w))
 	if err != nil {
 		log.Println("WebSocket Upgrade error:", err)
 		http.Error(w, "Could not open WebSocket connection", http.StatusInternalServerError)
@@ -48,8 +70,13 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	defer conn.Close()
 
 	var initialMessage struct {
-		Username string `json:"username"`
-		RoomID   string `json:"roomID"`
+		Username  string `json:"username"`
+		RoomID    string `json:"roomID"`
+		Team      int    `json:"team"`
+		Spectate  bool   `json:"spectate"`
+		Password  string `json:"password"`
+		JoinToken string `json:"joinToken"`
+		Token     string `json:"token"`
 	}
 	if err := conn.ReadJSON(&initialMessage); err != nil {
 		log.Println("Failed to read initial message:", err)
@@ -57,50 +84,133 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, exists := rooms[initialMessage.RoomID]
+	if shuttingDown.Load() {
+		conn.WriteJSON(map[string]string{"error": "Server is shutting down. Please try again later."})
+		return
+	}
+
+	room, exists := lookupRoom(initialMessage.RoomID)
 
 	if !exists {
 		conn.WriteJSON(map[string]string{"error": "Room not found"})
 		return
 	}
 
-	if len(room.Players) >= 9 {
+	// Players coming from /api/joinroom have had the password checked
+	// already
+	if !validJoinToken(room, initialMessage.JoinToken) {
+		if err := checkRoomPassword(room, initialMessage.Password, clientAddress(r)); err != nil {
+			conn.WriteJSON(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	if initialMessage.Spectate {
+		spectateRoom(conn, room, initialMessage.Username)
+		return
+	}
+
+	if playerCount(room) >= maxPlayers {
 		conn.WriteJSON(map[string]string{"error": "Room is full, only 9 members can join in one room"})
 		return
 	}
 
+	identity := socketIdentity(r, initialMessage.Token)
+
+	// Players without a name play under the one they last used
+	if initialMessage.Username == "" {
+		initialMessage.Username = identity.Username
+	}
+
 	// Create a new player instance
 	player := &game.Player{
 		ID:        generatePlayerID(),
+		ProfileID: identity.ID,
 		Username:  initialMessage.Username,
 		Score:     0,
 		Completed: false,
 		Conn:      conn,
 	}
 
-	// Add the player to the room's Players map
+	// Players pick a team or are balanced into the smallest one
+	if room.Teams > 0 {
+		team, err := assignTeam(room, player, initialMessage.Team)
+		if err != nil {
+			conn.WriteJSON(map[string]string{"error": err.Error()})
+			return
+		}
+		player.Team = team
+	}
+
+	// Add the player to the room's Players map, unless the room filled up
+	// while they were joining
+	room.Lock()
+	if len(room.Players) >= maxPlayers {
+		room.Unlock()
+		conn.WriteJSON(map[string]string{"error": "Room is full, only 9 members can join in one room"})
+		return
+	}
 	room.Players[conn] = player
+	room.Unlock()
+	notifyLobby()
+	saveRoom(room)
 
 	// Notify all players about the new player
+	joined := map[string]interface{}{
+		"username": player.Username,
+		"score":    player.Score,
+		"id":       player.ID,
+	}
+	if room.Teams > 0 {
+		joined["team"] = player.Team
+	}
 	broadcastToRoom(room, map[string]interface{}{
 		"event": "playerJoined",
-		"data": map[string]interface{}{
-			"username": player.Username,
-			"score":    player.Score,
-			"id":       player.ID,
-		},
+		"data":  joined,
 	})
 
+	// Messages are read on their own goroutine so that the loop below can
+	// also react to the per-question timer of blitz rooms
+	done := make(chan struct{})
+	defer close(done)
+	messages := readMessages(conn, player, done)
+
+	var clock *questionClock
+	defer func() { clock.stop() }()
+	asked := newBlitzQuestions()
+
 	// WebSocket communication loop
 	for {
-		var message struct {
-			Event string      `json:"event"`
-			Data  interface{} `json:"data"`
+		var message wsMessage
+		var ok bool
+
+		select {
+		case message, ok = <-messages:
+		case <-clock.tick():
+			player.Send(map[string]interface{}{
+				"event": "question_timer",
+				"data": map[string]interface{}{
+					"question_index": clock.index,
+					"remaining":      clock.remaining(),
+				},
+			})
+			// Zoom questions reveal more of the flag as time runs out
+			if room.GameMode == game.GameTypeZoom {
+				level := int(float64(clock.elapsed()) / float64(clock.limit) * float64(maxRevealLevel+1))
+				revealFragment(room, player, level)
+			}
+			continue
+		case <-clock.expired():
+			// Unanswered questions count as wrong once time runs out
+			index := clock.index
+			clock.stop()
+			clock = nil
+			asked.close(index)
+			submitAnswer(room, player, index, "", 0, true)
+			continue
 		}
 
-		err := conn.ReadJSON(&message)
-		if err != nil {
-			log.Printf("WebSocket connection closed for player %s: %v", player.Username, err)
+		if !ok {
 			break
 		}
 
@@ -111,33 +221,7 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 			return
 
 		case "loadgame":
-			for i := 3; i >= 0; i-- {
-				broadcastToRoom(room, map[string]interface{}{
-					"event": "countdown",
-					"data":  i,
-				})
-				time.Sleep(1 * time.Second)
-			}
-
-			room.Start = true
-
-			broadcastToRoom(room, map[string]interface{}{
-				"event": "gameStarted",
-			})
-
-			go func(room *game.Room) {
-				time.Sleep(time.Duration(room.TimeLimit) * time.Minute)
-
-				broadcastToRoom(room, map[string]interface{}{
-					"event": "time_over",
-				})
-
-				for conn := range room.Players {
-					conn.Close()
-				}
-
-				delete(rooms, room.Code)
-			}(room)
+			startGame(room)
 
 		case "get_new_question":
 			// When a client sends this event, it will send the question index for the question
@@ -151,23 +235,46 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 					questionNumber = int(questionNumberFloat)
 				} else {
 					log.Println("Invalid question_number type")
-					conn.WriteJSON(map[string]string{"error": "Invalid question number"})
+					player.Send(map[string]string{"error": "Invalid question number"})
 					continue
 				}
 			} else {
 				log.Println("Invalid data format for get_new_question")
-				conn.WriteJSON(map[string]string{"error": "Invalid data format"})
+				player.Send(map[string]string{"error": "Invalid data format"})
+				continue
+			}
+
+			blitz := room.QuestionTimeLimit > 0 && !player.Completed
+			if blitz && asked.isClosed(questionNumber) {
+				player.Send(map[string]string{"error": "Question has already been answered"})
 				continue
 			}
 
 			question, err := getQuestion(room, questionNumber)
 			if err != nil {
 				log.Println("Failed to get question:", err)
-				conn.WriteJSON(map[string]string{"error": "Failed to get question"})
+				player.Send(map[string]string{"error": "Failed to get question"})
 				continue
 			}
 
-			err = conn.WriteJSON(map[string]interface{}{
+			// Spectators follow each player's progress through the game
+			player.QuestionIndex = questionNumber
+			broadcastToSpectators(room, map[string]interface{}{
+				"event": "player_progress",
+				"data":  playerProgress(room, player),
+			})
+
+			if room.GameMode == game.GameTypeZoom {
+				player.RevealIndex = questionNumber
+				player.RevealLevel = 0
+				if err := addFragment(question, room.Questions[strconv.Itoa(questionNumber)], 0); err != nil {
+					log.Println("Failed to crop flag:", err)
+					player.Send(map[string]string{"error": "Failed to get question"})
+					continue
+				}
+			}
+
+			err = player.Send(map[string]interface{}{
 				"event": "new_question",
 				"data":  question,
 			})
@@ -175,15 +282,95 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 				log.Println("Error sending question to player:", err)
 			}
 
+			// In blitz rooms the clock starts when the question is first sent;
+			// asking for it again keeps the clock running from then
+			if blitz && (clock == nil || clock.index != questionNumber) {
+				clock.stop()
+				clock = startQuestionClock(questionNumber, time.Duration(room.QuestionTimeLimit)*time.Second, asked.start(questionNumber))
+			}
+
+		case "reveal_more":
+			// Shows the next, larger fragment of the current zoom question
+			dataMap, ok := message.Data.(map[string]interface{})
+			if !ok {
+				player.Send(map[string]string{"error": "Invalid data format"})
+				continue
+			}
+
+			questionIndex, ok := dataMap["question_index"].(float64)
+			if !ok || room.GameMode != game.GameTypeZoom || player.Completed || int(questionIndex) != player.RevealIndex {
+				player.Send(map[string]string{"error": "Question is not active"})
+				continue
+			}
+
+			revealFragment(room, player, player.RevealLevel+1)
+
+		case "chain_answer":
+			// Extends the player's chain in a neighbour chain room with a
+			// country named or clicked on the map
+			dataMap, ok := message.Data.(map[string]interface{})
+			if !ok {
+				player.Send(map[string]string{"error": "Invalid data format"})
+				continue
+			}
+
+			answer, ok := dataMap["answer"].(string)
+			if !ok {
+				player.Send(map[string]string{"error": "Invalid answer"})
+				continue
+			}
+
+			if room.GameMode != game.GameTypeNeighbourChain || !room.Start || player.Completed {
+				player.Send(map[string]string{"error": "No chain in progress"})
+				continue
+			}
+
+			submitChainAnswer(room, player, answer)
+
+		case "pick_team":
+			// Moves the player to another team while the room is in the lobby
+			dataMap, ok := message.Data.(map[string]interface{})
+			if !ok {
+				player.Send(map[string]string{"error": "Invalid data format"})
+				continue
+			}
+
+			requested, ok := dataMap["team"].(float64)
+			if !ok || room.Teams == 0 || room.Start {
+				player.Send(map[string]string{"error": "Teams cannot be changed now"})
+				continue
+			}
+
+			team, err := assignTeam(room, player, int(requested))
+			if err != nil {
+				player.Send(map[string]string{"error": err.Error()})
+				continue
+			}
+			player.Team = team
+
+			broadcastToRoom(room, map[string]interface{}{
+				"event": "team_changed",
+				"data": map[string]interface{}{
+					"id":       player.ID,
+					"username": player.Username,
+					"team":     player.Team,
+				},
+			})
+
 		case "clean_room":
 			// After all players have finished the game, the memory
 			// is cleared and all room and player instances are erased
 			if allPlayersCompleted(room) {
-				for conn := range room.Players {
+				for conn := range roomPlayers(room) {
 					conn.Close()
 				}
+				closeSpectators(room, "room_closed")
+				stopGameTimer(room)
 
-				delete(rooms, initialMessage.RoomID)
+				if unregisterRoom(room) {
+					forgetRoom(room.Code)
+				}
+				notifyLobby()
 			}
 
 		case "validate_answer":
@@ -194,7 +381,7 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 			rawData, ok := message.Data.(map[string]interface{})
 			if !ok {
 				log.Println("Invalid data type for validate_answer")
-				conn.WriteJSON(map[string]string{"error": "Invalid data format"})
+				player.Send(map[string]string{"error": "Invalid data format"})
 				continue
 			}
 
@@ -206,68 +393,247 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 			if questionIndex, ok := rawData["question_index"].(float64); ok {
 				data.QuestionIndex = int(questionIndex)
 			} else {
-				conn.WriteJSON(map[string]string{"error": "Invalid question index"})
+				player.Send(map[string]string{"error": "Invalid question index"})
 				continue
 			}
 
 			if answer, ok := rawData["answer"].(string); ok {
 				data.Answer = answer
 			} else {
-				conn.WriteJSON(map[string]string{"error": "Invalid answer"})
+				player.Send(map[string]string{"error": "Invalid answer"})
 				continue
 			}
 
 			if data.QuestionIndex < 0 || data.QuestionIndex >= len(room.Questions) {
-				conn.WriteJSON(map[string]string{"error": "Invalid question index"})
+				player.Send(map[string]string{"error": "Invalid question index"})
 				continue
 			}
 
-			question := room.Questions[strconv.Itoa(data.QuestionIndex)]
-			isCorrect := question.Answer == data.Answer
+			if player.Completed {
+				player.Send(map[string]string{"error": "You have already finished the game"})
+				continue
+			}
 
-			messageResponse := map[string]interface{}{
-				"event": "answer_result",
-				"data": map[string]interface{}{
-					"correct_answer": question.Answer,
-					"chosen_answer":  data.Answer,
-				},
+			if room.GameMode == game.GameTypeNeighbourChain {
+				player.Send(map[string]string{"error": "Neighbour chains are answered with chain_answer"})
+				continue
 			}
 
-			err := conn.WriteJSON(messageResponse)
-			if err != nil {
-				log.Println("Error sending validation response to player:", err)
+			if player.Answered[data.QuestionIndex] {
+				player.Send(map[string]string{"error": "Question has already been answered"})
+				continue
 			}
 
-			if isCorrect {
-				player.Score++
-				broadcastToRoom(room, map[string]interface{}{
-					"event": "score",
-					"data": map[string]interface{}{
-						"username": player.Username,
-						"score":    player.Score,
-					},
-				})
+			// Blitz answers only count for the question currently on the clock
+			var elapsed time.Duration
+			if room.QuestionTimeLimit > 0 {
+				if clock == nil || clock.index != data.QuestionIndex {
+					player.Send(map[string]string{"error": "Question is not active"})
+					continue
+				}
+				elapsed = clock.elapsed()
+				clock.stop()
+				clock = nil
+				asked.close(data.QuestionIndex)
 			}
 
-			if data.QuestionIndex+1 == len(room.Questions) {
-				player.Completed = true
-				broadcastToRoom(room, map[string]interface{}{
-					"event":    "finished_game",
-					"username": player.Username,
-				})
+			submitAnswer(room, player, data.QuestionIndex, data.Answer, elapsed, false)
+		}
+	}
 
-				if allPlayersCompleted(room) {
-					broadcastToRoom(room, map[string]interface{}{
-						"event": "all_players_finished",
-					})
-				}
+	removePlayerFromRoom(initialMessage.RoomID, room, conn, player)
+}
 
+// startGame counts the room down, starts the game and closes the room once
+// its time limit is up. Rooms that have already started are left alone.
+func startGame(room *game.Room) {
+	room.Lock()
+	if room.Start || room.Starting {
+		room.Unlock()
+		return
+	}
+	room.Starting = true
+	room.Unlock()
+
+	for i := 3; i >= 0; i-- {
+		broadcastToRoom(room, map[string]interface{}{
+			"event": "countdown",
+			"data":  i,
+		})
+		time.Sleep(1 * time.Second)
+	}
+
+	// The room may have closed during the countdown
+	if current, ok := lookupRoom(room.Code); !ok || current != room {
+		return
+	}
+
+	contestants := playerCount(room)
+	room.Lock()
+	room.Start = true
+	room.Contestants = contestants
+	room.Unlock()
+	notifyLobby()
+	saveRoom(room)
+
+	broadcastToRoom(room, map[string]interface{}{
+		"event": "gameStarted",
+	})
+
+	room.Lock()
+	room.GameTimer = time.AfterFunc(time.Duration(room.TimeLimit)*time.Minute, func() {
+		timeOver := map[string]interface{}{
+			"event": "time_over",
+		}
+		if ratings := ratingUpdates(recordResult(room, "time_over")); ratings != nil {
+			timeOver["data"] = map[string]interface{}{
+				"ratings": ratings,
 			}
+		}
+		broadcastToRoom(room, timeOver)
+
+		closeRoom(room, "time_over")
+	})
+	room.Unlock()
+}
+
+// submitAnswer scores a player's answer to a question, sends the result to
+// the player and broadcasts score and completion updates to the room.
+// Timed out answers from blitz rooms are always wrong; elapsed is the time
+// taken to answer and only matters in blitz rooms. Each question is only
+// scored the first time a player answers it.
+func submitAnswer(room *game.Room, player *game.Player, questionIndex int, answer string, elapsed time.Duration, timedOut bool) {
+	if player.Answered[questionIndex] {
+		return
+	}
+	if player.Answered == nil {
+		player.Answered = make(map[int]bool)
+	}
+	player.Answered[questionIndex] = true
+
+	question := room.Questions[strconv.Itoa(questionIndex)]
+	isCorrect := !timedOut && question.Answer == answer
+
+	messageResponse := map[string]interface{}{
+		"event": "answer_result",
+		"data": map[string]interface{}{
+			"correct_answer": question.Answer,
+			"chosen_answer":  answer,
+			"timed_out":      timedOut,
+		},
+	}
 
+	if err := player.Send(messageResponse); err != nil {
+		log.Println("Error sending validation response to player:", err)
+	}
+
+	if isCorrect {
+		switch {
+		case room.GameMode == game.GameTypeZoom:
+			player.Score += zoomPoints(player.RevealLevel)
+		case room.QuestionTimeLimit > 0:
+			player.Score += speedPoints(elapsed, time.Duration(room.QuestionTimeLimit)*time.Second)
+		default:
+			player.Score++
+		}
+		player.Streak++
+		if player.Streak > player.BestStreak {
+			player.BestStreak = player.Streak
 		}
+		broadcastToRoom(room, scoreEvent(room, player))
+	} else {
+		player.Streak = 0
 	}
 
-	removePlayerFromRoom(initialMessage.RoomID, room, conn, player)
+	// In streak modes the first miss ends the player's run
+	runOver := game.IsStreakMode(room.GameMode) && !isCorrect
+
+	if questionIndex+1 == len(room.Questions) || runOver {
+		completeRun(room, player, runOver)
+	}
+}
+
+// completeRun marks a player as finished and ends the game once every
+// player is done. runOver is set when the run was cut short by a miss.
+func completeRun(room *game.Room, player *game.Player, runOver bool) {
+	player.Completed = true
+	finished := map[string]interface{}{
+		"event":       "finished_game",
+		"username":    player.Username,
+		"best_streak": player.BestStreak,
+	}
+	if room.Teams > 0 {
+		finished["team"] = player.Team
+		finished["teams"] = teamStandings(room)
+	}
+	broadcastToRoom(room, finished)
+
+	if runOver && room.GameMode == game.GameTypeSurvival {
+		eliminatePlayer(room, player)
+	}
+	saveRoom(room)
+
+	if allPlayersCompleted(room) {
+		finishGame(room)
+	}
+}
+
+// finishGame records the result of a game every player is done with and
+// broadcasts "all_players_finished" with the rating changes.
+func finishGame(room *game.Room) {
+	if !markFinished(room) {
+		return
+	}
+
+	declareSurvivalWinnerByScore(room)
+	result := storeResult(room, "completed")
+	notifyLobby()
+	allFinished := map[string]interface{}{
+		"event": "all_players_finished",
+	}
+	data := map[string]interface{}{}
+	if room.Teams > 0 {
+		data["teams"] = teamStandings(room)
+	}
+	if ratings := ratingUpdates(result); ratings != nil {
+		data["ratings"] = ratings
+	}
+	if len(data) > 0 {
+		allFinished["data"] = data
+	}
+	broadcastToRoom(room, allFinished)
+}
+
+// wsMessage is an event sent by a client over the WebSocket.
+type wsMessage struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// readMessages reads client events on a separate goroutine until the
+// connection fails or done is closed. The returned channel is closed when
+// reading stops.
+func readMessages(conn *websocket.Conn, player *game.Player, done <-chan struct{}) <-chan wsMessage {
+	messages := make(chan wsMessage)
+
+	go func() {
+		defer close(messages)
+		for {
+			var message wsMessage
+			if err := conn.ReadJSON(&message); err != nil {
+				log.Printf("WebSocket connection closed for player %s: %v", player.Username, err)
+				return
+			}
+
+			select {
+			case messages <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return messages
 }
 
 // removePlayerFromRoom removes a player from a game room and performs necessary cleanup.
@@ -283,11 +649,11 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 // The function performs the following operations:
 //   - Removes the player from the room's Players map
 //   - Notifies remaining players about the departure
+//   - Declares the winner of a survival game if one player is left standing
 //   - Cleans up empty rooms
 //   - Handles thread-safe access to shared resources
 func removePlayerFromRoom(roomID string, room *game.Room, conn *websocket.Conn, player *game.Player) {
-	delete(room.Players, conn)
-	remainingPlayers := len(room.Players)
+	remainingPlayers := dropPlayer(room, conn)
 
 	// Notify remaining players
 	broadcastToRoom(room, map[string]interface{}{
@@ -298,13 +664,27 @@ func removePlayerFromRoom(roomID string, room *game.Room, conn *websocket.Conn,
 		},
 	})
 
+	// Leaving a survival game can leave a single player standing, and
+	// leaving any game can leave only players who are done
+	checkSurvivalWinner(room)
+	if remainingPlayers > 0 && allPlayersCompleted(room) {
+		finishGame(room)
+	}
+
 	if remainingPlayers == 0 {
-		delete(rooms, roomID)
+		closeSpectators(room, "room_closed")
+		stopGameTimer(room)
+		if unregisterRoom(room) {
+			forgetRoom(roomID)
+		}
 		log.Printf("Room %s has been closed.", roomID)
+	} else {
+		saveRoom(room)
 	}
+	notifyLobby()
 }
 
-// broadcastToRoom sends a message to all players in a specified room.
+// broadcastToRoom sends a message to all players and spectators in a specified room.
 // It safely handles concurrent access to the room's player list and manages
 // failed message deliveries by removing disconnected players.
 //
@@ -317,13 +697,15 @@ func removePlayerFromRoom(roomID string, room *game.Room, conn *websocket.Conn,
 //   - Attempts to send the message to each connected player
 //   - Handles failed sends by closing connections and removing players
 func broadcastToRoom(room *game.Room, message interface{}) {
-	for conn, player := range room.Players {
-		if err := conn.WriteJSON(message); err != nil {
+	for conn, player := range roomPlayers(room) {
+		if err := player.Send(message); err != nil {
 			log.Printf("Error broadcasting message to player %s: %v", player.Username, err)
 			conn.Close()
-			delete(room.Players, conn)
+			dropPlayer(room, conn)
 		}
 	}
+
+	broadcastToSpectators(room, message)
 }
 
 // sendToPlayer sends a message to a specific player in a room.
@@ -348,7 +730,7 @@ func sendToPlayer(room *game.Room, playerID string, message interface{}) error {
 	var targetConn *websocket.Conn
 	var targetPlayer *game.Player
 
-	for conn, player := range room.Players {
+	for conn, player := range roomPlayers(room) {
 		if player.ID == playerID {
 			targetConn = conn
 			targetPlayer = player
@@ -360,10 +742,10 @@ func sendToPlayer(room *game.Room, playerID string, message interface{}) error {
 		return fmt.Errorf("player with ID %s not found in room", playerID)
 	}
 
-	if err := targetConn.WriteJSON(message); err != nil {
+	if err := targetPlayer.Send(message); err != nil {
 		log.Printf("Error sending message to player %s: %v", targetPlayer.Username, err)
 		targetConn.Close()
-		delete(room.Players, targetConn)
+		dropPlayer(room, targetConn)
 		return err
 	}
 
@@ -384,12 +766,18 @@ func sendToPlayer(room *game.Room, playerID string, message interface{}) error {
 //   - The question with the specified number is not found in the room
 //
 // Behavior:
-//   - If the room's GameMode is "mcq", the returned map includes the question's options and flag URL.
-//   - For other game modes, the map contains only the flag URL.
+//   - The flag URL and prompt are included when the question has them.
+//   - For game modes answered by picking an option (MCQ and the capital modes),
+//     the map also includes the question's options.
 //
 // Example return values:
 //   - For MCQ mode: {"options": [...], "flag_url": "..."}
-//   - For non-MCQ mode: {"flag_url": "..."}
+//   - For MAP mode: {"flag_url": "..."}
+//   - For CAPITAL mode: {"options": [...], "flag_url": "...", "prompt": "France"}
+//   - For CAPITAL_FLAG mode: {"options": ["/static/svg/FR.svg", ...], "prompt": "Paris"}
+//
+// ZOOM questions are sent with the flag cropped to the player's reveal
+// level instead of its URL, see addFragment.
 func getQuestion(room *game.Room, questionNumber int) (map[string]interface{}, error) {
 	if room == nil {
 		return nil, fmt.Errorf("room is nil")
@@ -414,14 +802,24 @@ func getQuestion(room *game.Room, questionNumber int) (map[string]interface{}, e
 		return nil, fmt.Errorf("question with number %d not found", questionNumber)
 	}
 
-	data := map[string]interface{}{
-		"flag_url": question.FlagURL,
+	data := map[string]interface{}{}
+
+	if question.FlagURL != "" {
+		data["flag_url"] = question.FlagURL
+	}
+
+	if question.Prompt != "" {
+		data["prompt"] = question.Prompt
 	}
 
-	if room.GameMode == "MCQ" {
+	if game.HasOptions(room.GameMode) {
 		data["options"] = question.Options
 	}
 
+	if room.QuestionTimeLimit > 0 {
+		data["time_limit"] = room.QuestionTimeLimit
+	}
+
 	return data, nil
 }
 
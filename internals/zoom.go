@@ -0,0 +1,205 @@
+package internals
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adimail/fun-with-flags/internals/game"
+	"github.com/gorilla/mux"
+)
+
+// zoomQuestionTTL is how long a single-player zoom question can be played.
+const zoomQuestionTTL = time.Hour
+
+// maxZoomQuestions bounds the single-player zoom questions kept at once.
+const maxZoomQuestions = 10000
+
+// zoomQuestion is a single-player zoom question kept on the server, so the
+// client only ever sees an opaque id and cropped fragments of the flag.
+type zoomQuestion struct {
+	question game.Question
+	level    int // largest fragment served so far
+	answered bool
+	created  time.Time
+}
+
+var (
+	zoomMu        sync.Mutex
+	zoomQuestions = make(map[string]*zoomQuestion)
+)
+
+var (
+	errZoomNotFound = errors.New("zoom question not found")
+	errZoomBusy     = errors.New("too many zoom questions in play, try again later")
+)
+
+// cleanupZoomQuestions forgets zoom questions older than zoomQuestionTTL.
+// Callers must hold zoomMu.
+func cleanupZoomQuestions(now time.Time) {
+	for id, q := range zoomQuestions {
+		if now.Sub(q.created) > zoomQuestionTTL {
+			delete(zoomQuestions, id)
+		}
+	}
+}
+
+// registerZoomQuestions keeps single-player zoom questions on the server
+// and returns what the client is shown of them: an id, the options and
+// the number of reveal levels, but neither the flag nor the answer.
+func registerZoomQuestions(questions []game.Question) ([]map[string]interface{}, error) {
+	now := time.Now()
+
+	zoomMu.Lock()
+	defer zoomMu.Unlock()
+
+	cleanupZoomQuestions(now)
+	if len(zoomQuestions)+len(questions) > maxZoomQuestions {
+		return nil, errZoomBusy
+	}
+
+	views := make([]map[string]interface{}, 0, len(questions))
+	for _, question := range questions {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return nil, err
+		}
+
+		key := hex.EncodeToString(id)
+		zoomQuestions[key] = &zoomQuestion{question: question, created: now}
+		views = append(views, map[string]interface{}{
+			"id":               key,
+			"options":          question.Options,
+			"max_reveal_level": maxRevealLevel,
+		})
+	}
+	return views, nil
+}
+
+func getZoomQuestion(id string) (*zoomQuestion, error) {
+	q, ok := zoomQuestions[id]
+	if !ok || time.Since(q.created) > zoomQuestionTTL {
+		return nil, errZoomNotFound
+	}
+	return q, nil
+}
+
+// zoomFragmentHandler serves a cropped fragment of the flag of a
+// single-player zoom question. Asking for a level raises the question's
+// reveal level, which lowers its points.
+//
+// HTTP Method: GET
+// Path Parameter:
+//   - id: Question identifier
+//
+// Query Parameters:
+//   - level: Reveal level, from 0 (smallest fragment) to the whole flag
+//
+// Response:
+//   - 200: The cropped SVG
+//   - 400: Invalid level
+//   - 404: Question not found
+//   - 500: The flag could not be read or cropped
+func zoomFragmentHandler(w http.ResponseWriter, r *http.Request) {
+	level, err := strconv.Atoi(r.URL.Query().Get("level"))
+	if err != nil || level < 0 || level > maxRevealLevel {
+		http.Error(w, fmt.Sprintf("Level must be between 0 and %d", maxRevealLevel), http.StatusBadRequest)
+		return
+	}
+
+	zoomMu.Lock()
+	q, err := getZoomQuestion(mux.Vars(r)["id"])
+	var question game.Question
+	if err == nil {
+		if level > q.level && !q.answered {
+			q.level = level
+		}
+		question = q.question
+	}
+	zoomMu.Unlock()
+
+	if err != nil {
+		http.Error(w, "Question not found", http.StatusNotFound)
+		return
+	}
+
+	fragment, err := flagFragment(question.Country, question.Seed, level)
+	if err != nil {
+		http.Error(w, "Failed to crop flag: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write(fragment)
+}
+
+// zoomAnswerHandler checks the answer to a single-player zoom question.
+// Each question can be answered once.
+//
+// HTTP Method: POST
+// Content-Type: application/json
+// Path Parameter:
+//   - id: Question identifier
+//
+// Request Body:
+//   - answer: The chosen country name
+//
+// Response:
+//   - 200: Whether the answer was correct, the correct answer and the
+//     points earned at the largest reveal level served
+//   - 400: Invalid request
+//   - 404: Question not found
+//   - 409: The question has already been answered
+func zoomAnswerHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Answer string `json:"answer"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON format"})
+		return
+	}
+
+	zoomMu.Lock()
+	defer zoomMu.Unlock()
+
+	q, err := getZoomQuestion(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if q.answered {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Question has already been answered"})
+		return
+	}
+	q.answered = true
+
+	isCorrect := q.question.Answer == req.Answer
+	points := 0
+	if isCorrect {
+		points = zoomPoints(q.level)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"correct":        isCorrect,
+		"correct_answer": q.question.Answer,
+		"chosen_answer":  req.Answer,
+		"reveal_level":   q.level,
+		"points":         points,
+	})
+}
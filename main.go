@@ -1,23 +1,117 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/adimail/fun-with-flags/internals"
+	"github.com/adimail/fun-with-flags/internals/store"
 )
 
 func main() {
 	const PORT = 8080
+
+	if len(os.Args) > 1 && os.Args[1] == "validate-data" {
+		os.Exit(validateData(os.Args[2:]))
+	}
+
+	grace := flag.Duration("shutdown-grace", 30*time.Second, "countdown announced to active rooms before the server stops")
+	finishGames := flag.Bool("finish-games", true, "let in-flight games finish within the shutdown grace period")
+	assetsDir := flag.String("assets-dir", "", "serve the frontend and dataset from this directory instead of the embedded copy")
+	dataDir := flag.String("data-dir", "./data", "directory game results, player profiles and room snapshots are kept in")
+	secretFile := flag.String("secret-file", "./data/server.key", "file holding the secret guest identities are signed with, created if missing")
+	flag.Parse()
+
+	if *assetsDir != "" {
+		log.Printf("Serving assets from %s\n", *assetsDir)
+	}
+	useAssets(*assetsDir)
+
+	if err := internals.LoadSecret(*secretFile); err != nil {
+		log.Fatal("Failed to load server secret: ", err)
+	}
+
+	internals.SetStore(store.NewFile(*dataDir))
+	if recovered, err := internals.RecoverRooms(); err != nil {
+		log.Println("Failed to recover interrupted games:", err)
+	} else if recovered > 0 {
+		log.Printf("Recorded %d games interrupted by the last shutdown\n", recovered)
+	}
+	if counted, err := internals.LoadLeaderboards(); err != nil {
+		log.Println("Failed to load leaderboards:", err)
+	} else {
+		log.Printf("Loaded leaderboards from %d results\n", counted)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	r := internals.Router()
 
-	go internals.StartRoomCleanup(15 * time.Minute)
+	go internals.StartRoomCleanup(ctx, 15*time.Minute)
 
 	address := fmt.Sprintf(":%d", PORT)
-	log.Printf("Server started at %s\n", address)
-	if err := http.ListenAndServe(address, r); err != nil {
-		log.Fatal("ListenAndServe: ", err)
+	server := &http.Server{Addr: address, Handler: r}
+
+	go func() {
+		log.Printf("Server started at %s\n", address)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("ListenAndServe: ", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down, draining active rooms")
+
+	// Allow a little slack past the announced countdown for closing frames
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *grace+5*time.Second)
+	defer cancel()
+
+	internals.Shutdown(shutdownCtx, internals.ShutdownOptions{
+		Grace:       *grace,
+		FinishGames: *finishGames,
+	})
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Server shutdown error:", err)
+	}
+	log.Println("Server stopped")
+}
+
+// useAssets points the server at the embedded assets, or at dir when set.
+func useAssets(dir string) {
+	if dir != "" {
+		internals.SetAssets(os.DirFS(dir))
+	} else {
+		internals.SetAssets(embeddedAssets)
+	}
+}
+
+// validateData implements the "validate-data" subcommand. It cross-checks
+// the country list, flags and map data and returns the process exit code.
+func validateData(args []string) int {
+	cmd := flag.NewFlagSet("validate-data", flag.ExitOnError)
+	assetsDir := cmd.String("assets-dir", "", "validate the dataset in this directory instead of the embedded copy")
+	cmd.Parse(args)
+
+	useAssets(*assetsDir)
+
+	errorsFound, err := internals.ValidateData(os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "validate-data:", err)
+		return 2
+	}
+	if errorsFound > 0 {
+		return 1
 	}
+	return 0
 }